@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/config"
+	"lemon/lemon-api/pkg/export"
+	"lemon/lemon-api/pkg/postgres"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// exportFeedback implements the export-feedback subcommand, which writes a
+// game's feedback straight from the database in the same formats as
+// GET api/feedback/export. It returns the process exit code.
+func exportFeedback(args []string) int {
+	flags := flag.NewFlagSet("export-feedback", flag.ContinueOnError)
+	configPath := flags.String("config", "config.json", "path to the config file")
+	gameSlug := flags.String("game", "", "slug of the game to export, defaults to the configured default game")
+	format := flags.String("format", export.FormatCSV, "csv or ndjson")
+	output := flags.String("out", "", "file to write to, defaults to stdout")
+
+	var filter lemon_api.FeedbackFilter
+	flags.StringVar(&filter.Type, "type", "", "only feedback of this type")
+	flags.StringVar(&filter.Status, "status", "", "only feedback in this status")
+	flags.StringVar(&filter.Build, "build", "", "only feedback from this build")
+	flags.StringVar(&filter.Platform, "platform", "", "only feedback from this platform")
+	flags.StringVar(&filter.Sort, "sort", "", "submitted, rating or id")
+	flags.StringVar(&filter.Order, "order", "", "asc or desc")
+	minRating := flags.Int64("min-rating", -1, "only feedback rated at least this")
+	maxRating := flags.Int64("max-rating", -1, "only feedback rated at most this")
+	from := flags.String("from", "", "only feedback submitted at or after this RFC 3339 time")
+	to := flags.String("to", "", "only feedback submitted before this RFC 3339 time")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *minRating >= 0 {
+		filter.MinRating = minRating
+	}
+	if *maxRating >= 0 {
+		filter.MaxRating = maxRating
+	}
+	for _, bound := range []struct {
+		value string
+		dest  **time.Time
+	}{{*from, &filter.From}, {*to, &filter.To}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid time %q: %v\n", bound.value, err)
+			return 2
+		}
+		t = t.UTC()
+		*bound.dest = &t
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":  *configPath,
+			"error": err,
+		}).Error("error loading config")
+		return 1
+	}
+
+	database, err := postgres.NewService(cfg)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("unable to start database service")
+		return 1
+	}
+	defer database.Close()
+
+	slug := *gameSlug
+	if slug == "" && cfg.API != nil {
+		slug = cfg.API.DefaultGame
+	}
+	game, err := database.GetGameBySlug(slug)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"game":  slug,
+			"error": err,
+		}).Error("unknown game")
+		return 1
+	}
+	filter.GameID = game.ID
+
+	var out io.Writer = os.Stdout
+	var file *os.File
+	if *output != "" {
+		file, err = os.Create(*output)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path":  *output,
+				"error": err,
+			}).Error("unable to create export file")
+			return 1
+		}
+		// Closed again below once the export is written, so a failed final
+		// write isn't lost; this only covers the early returns.
+		defer file.Close()
+		out = file
+	}
+	buffered := bufio.NewWriter(out)
+
+	writer, err := export.NewFeedbackWriter(*format, buffered)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "format must be csv or ndjson")
+		return 2
+	}
+
+	rows := 0
+	err = database.ExportFeedback(filter, func(feedback *lemon_api.Feedback) error {
+		rows++
+		return writer.Write(feedback)
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err == nil && file != nil {
+		err = file.Close()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"rows":  rows,
+		}).Error("unable to export feedback")
+		return 1
+	}
+
+	log.WithFields(log.Fields{
+		"game": slug,
+		"rows": rows,
+	}).Info("Exported feedback")
+	return 0
+}
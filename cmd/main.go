@@ -1,7 +1,10 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"lemon/lemon-api/pkg/config"
 	"lemon/lemon-api/pkg/rest"
@@ -11,6 +14,10 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "export-feedback" {
+		os.Exit(exportFeedback(os.Args[2:]))
+	}
+
 	log.Info("Started Lemon API Server")
 
 	cfg, err := config.LoadConfig("config.json")
@@ -19,7 +26,14 @@ func main() {
 			"path":  "config.json",
 			"error": err,
 		}).Error("error loading config")
-		return
+		os.Exit(1)
+	}
+	if cfg.API == nil {
+		log.WithFields(log.Fields{
+			"path":  "config.json",
+			"error": config.ErrInvalidConfig,
+		}).Error("config has no api section")
+		os.Exit(1)
 	}
 
 	webEngine := gin.New()
@@ -36,15 +50,48 @@ func main() {
 		return
 	}
 
-	w.Initialise()
+	if err := w.Initialise(); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("unable to start Lemon API Server")
+		os.Exit(1)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- w.Run()
+	}()
 
 	log.WithFields(log.Fields{
 		"port": cfg.API.Port,
 	}).Info("Lemon API Listening")
-	err = webEngine.Run(fmt.Sprintf("%v:%v", "0.0.0.0", cfg.API.Port))
-	if err != nil {
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Fatal("unable to start HTTP interface")
+		}
+		return
+	case sig := <-signals:
+		// A second signal kills the process without waiting.
+		signal.Stop(signals)
+		log.WithFields(log.Fields{
+			"signal": sig.String(),
+		}).Info("Shutting down Lemon API Server")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.ShutdownTimeout())
+	defer cancel()
+	if err := w.Shutdown(ctx); err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
-		}).Fatal("unable to start HTTP interface")
+		}).Error("unclean shutdown")
+		os.Exit(1)
 	}
+	log.Info("Stopped Lemon API Server")
 }
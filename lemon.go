@@ -1,28 +1,302 @@
 package lemon_api
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
 
 type User struct {
-	ID        string `json:"id" db:"id"`
-	Username  string `json:"username" db:"username"`
-	Hash      string `json:"hash" db:"hash"`
-	SaveState string `json:"save_state" db:"save_state"`
-	Role      string `json:"role" db:"role"`
+	ID          string `json:"id" db:"id"`
+	Username    string `json:"username" db:"username"`
+	Hash        string `json:"hash" db:"hash"`
+	SaveState   string `json:"save_state" db:"save_state"`
+	Signature   string `json:"signature" db:"save_signature"`
+	SaveVersion string `json:"save_version" db:"save_version"`
+	Role        string `json:"role" db:"role"`
 }
 
 type Role struct {
 	Name         string `json:"name" db:"name"`
 }
 
+type Game struct {
+	ID             string     `json:"id" db:"id"`
+	Slug           string     `json:"slug" db:"slug"`
+	Name           string     `json:"name" db:"name"`
+	APIKey         string     `json:"api_key,omitempty" db:"api_key"`
+	SharingEnabled bool       `json:"sharing_enabled" db:"sharing_enabled"`
+	Created        *time.Time `json:"created" db:"created"`
+}
+
+type GameDeveloperRequest struct {
+	Username string `json:"username"`
+}
+
 type Feedback struct {
+	ID          int64            `json:"id" db:"id"`
+	GameID      string           `json:"-" db:"game_id"`
+	AccountID   *string          `json:"account_id" db:"account_id"`
+	Rating      int64            `json:"rating" db:"rating"`
+	Description string           `json:"description" db:"description"`
+	Type        string           `json:"type" db:"type"`
+	Build       string           `json:"build" db:"build"`
+	Metadata    FeedbackMetadata `json:"metadata" db:"metadata"`
+	Submitted   *time.Time       `json:"submitted" db:"submitted"`
+	Read        bool             `json:"read" db:"read"`
+	Status      string           `json:"status" db:"status"`
+	AssigneeID  *string          `json:"assignee_id" db:"assignee_id"`
+	DuplicateOf *int64           `json:"duplicate_of" db:"duplicate_of"`
+
+	QuarantineReason *string `json:"quarantine_reason,omitempty" db:"quarantine_reason"`
+	// Website is a honeypot: clients hide it from players, so only bots fill it in.
+	Website string `json:"website,omitempty" db:"-"`
+}
+
+// PublicFeedback is what anyone may see of feedback. Who sent it, from which
+// session, and how it was triaged are only for the game's developers.
+type PublicFeedback struct {
+	ID          int64          `json:"id"`
+	Rating      int64          `json:"rating"`
+	Description string         `json:"description"`
+	Type        string         `json:"type"`
+	Build       string         `json:"build"`
+	Metadata    PublicMetadata `json:"metadata"`
+	Submitted   *time.Time     `json:"submitted"`
+	Read        bool           `json:"read"`
+}
+
+// PublicMetadata leaves the player's session and the game's free-form context
+// out of feedback metadata.
+type PublicMetadata struct {
+	Platform string `json:"platform,omitempty"`
+	Locale   string `json:"locale,omitempty"`
+	Scene    string `json:"scene,omitempty"`
+}
+
+// Public strips feedback down to what anyone may see.
+func (f *Feedback) Public() *PublicFeedback {
+	return &PublicFeedback{
+		ID:          f.ID,
+		Rating:      f.Rating,
+		Description: f.Description,
+		Type:        f.Type,
+		Build:       f.Build,
+		Metadata: PublicMetadata{
+			Platform: f.Metadata.Platform,
+			Locale:   f.Metadata.Locale,
+			Scene:    f.Metadata.Scene,
+		},
+		Submitted: f.Submitted,
+		Read:      f.Read,
+	}
+}
+
+// FeedbackMetadata describes where feedback came from. It is stored as a
+// single JSONB column so games can send whatever context suits them.
+type FeedbackMetadata struct {
+	Platform  string                 `json:"platform,omitempty"`
+	Locale    string                 `json:"locale,omitempty"`
+	Scene     string                 `json:"scene,omitempty"`
+	SessionID string                 `json:"session_id,omitempty"`
+	Context   map[string]interface{} `json:"context,omitempty"`
+}
+
+func (m FeedbackMetadata) Value() (driver.Value, error) {
+	return jsonValue(m)
+}
+
+func (m *FeedbackMetadata) Scan(src interface{}) error {
+	*m = FeedbackMetadata{}
+	return scanJSON(src, m)
+}
+
+// jsonValue and scanJSON store types in JSONB columns.
+func jsonValue(v interface{}) (driver.Value, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func scanJSON(src interface{}, dest interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	case nil:
+		return nil
+	}
+	return errors.New("unsupported JSON column type")
+}
+
+type FeedbackSearchResult struct {
+	Feedback
+	Rank float64 `json:"rank" db:"rank"`
+	// Snippet is escaped HTML with matched terms wrapped in <mark> tags.
+	Snippet string `json:"snippet" db:"snippet"`
+}
+
+type FeedbackStats struct {
+	Total              int64                `json:"total" db:"total"`
+	AverageRating      float64              `json:"average_rating" db:"average_rating"`
+	Unread             int64                `json:"unread" db:"unread"`
+	RatingDistribution []*RatingCount       `json:"rating_distribution"`
+	Types              []*FeedbackTypeStat  `json:"types"`
+	Series             []*FeedbackBucket    `json:"series"`
+	Builds             []*FeedbackBuildStat `json:"builds,omitempty"`
+}
+
+type RatingCount struct {
+	Rating int64 `json:"rating" db:"rating"`
+	Count  int64 `json:"count" db:"count"`
+}
+
+type FeedbackTypeStat struct {
+	Type   string `json:"type" db:"type"`
+	Count  int64  `json:"count" db:"count"`
+	Unread int64  `json:"unread" db:"unread"`
+}
+
+type FeedbackBucket struct {
+	Start         *time.Time `json:"start" db:"start"`
+	Count         int64      `json:"count" db:"count"`
+	AverageRating float64    `json:"average_rating" db:"average_rating"`
+}
+
+type FeedbackBuildStat struct {
+	Build         string  `json:"build" db:"build"`
+	Count         int64   `json:"count" db:"count"`
+	AverageRating float64 `json:"average_rating" db:"average_rating"`
+	Unread        int64   `json:"unread" db:"unread"`
+}
+
+type FeedbackAttachment struct {
 	ID          int64      `json:"id" db:"id"`
-	Rating      int64      `json:"rating" db:"rating"`
-	Description string     `json:"description" db:"description"`
-	Type        string     `json:"type" db:"type"`
-	Submitted   *time.Time `json:"submitted" db:"submitted"`
-	Read        bool       `json:"read" db:"read"`
+	FeedbackID  int64      `json:"feedback_id" db:"feedback_id"`
+	Filename    string     `json:"filename" db:"filename"`
+	ContentType string     `json:"content_type" db:"content_type"`
+	Size        int64      `json:"size" db:"size"`
+	StorageKey  string     `json:"-" db:"storage_key"`
+	Created     *time.Time `json:"created" db:"created"`
+	URL         string     `json:"url,omitempty" db:"-"`
 }
 
+// FeedbackReply is a message in the conversation between developers and the
+// player who submitted feedback. Unlike notes, replies are shown to the player.
+type FeedbackReply struct {
+	ID            int64      `json:"id" db:"id"`
+	FeedbackID    int64      `json:"feedback_id" db:"feedback_id"`
+	AuthorID      *string    `json:"author_id" db:"author_id"`
+	Author        string     `json:"author" db:"author"`
+	FromDeveloper bool       `json:"from_developer" db:"from_developer"`
+	Body          string     `json:"body" db:"body"`
+	PlayerRead    bool       `json:"player_read" db:"player_read"`
+	Created       *time.Time `json:"created" db:"created"`
+}
+
+// PlayerFeedback is feedback as its submitter sees it, with the replies to it
+// and how many of the developers' replies they haven't read yet.
+type PlayerFeedback struct {
+	Feedback
+	UnreadReplies int64            `json:"unread_replies" db:"unread_replies"`
+	Replies       []*FeedbackReply `json:"replies" db:"-"`
+}
+
+type FeedbackNote struct {
+	ID         int64      `json:"id" db:"id"`
+	FeedbackID int64      `json:"feedback_id" db:"feedback_id"`
+	AuthorID   *string    `json:"author_id" db:"author_id"`
+	Author     string     `json:"author" db:"author"`
+	Body       string     `json:"body" db:"body"`
+	Created    *time.Time `json:"created" db:"created"`
+}
+
+type FeedbackStatusChange struct {
+	ID         int64      `json:"id" db:"id"`
+	FeedbackID int64      `json:"feedback_id" db:"feedback_id"`
+	FromStatus string     `json:"from_status" db:"from_status"`
+	ToStatus   string     `json:"to_status" db:"to_status"`
+	ChangedBy  *string    `json:"changed_by" db:"changed_by"`
+	Changed    *time.Time `json:"changed" db:"changed"`
+}
+
+type FeedbackStatusRequest struct {
+	Status      string `json:"status"`
+	DuplicateOf *int64 `json:"duplicate_of"`
+}
+
+type FeedbackAssignRequest struct {
+	AssigneeID string `json:"assignee_id"`
+}
+
+// FeedbackFilter narrows and orders a feedback listing. Nil fields are not
+// filtered on. Cursor is the opaque value returned with the previous page.
+type FeedbackFilter struct {
+	GameID    string
+	Type      string
+	Status    string
+	Build     string
+	Platform  string
+	Locale    string
+	Scene     string
+	SessionID string
+	Context   map[string]interface{}
+	MinRating *int64
+	MaxRating *int64
+	Read      *bool
+	From      *time.Time
+	To        *time.Time
+	Sort      string
+	Order     string
+	Limit     int
+	Cursor    string
+}
+
+const (
+	FeedbackStatusNew        = "new"
+	FeedbackStatusTriaged    = "triaged"
+	FeedbackStatusInProgress = "in-progress"
+	FeedbackStatusResolved   = "resolved"
+	FeedbackStatusWontFix    = "wont-fix"
+	FeedbackStatusDuplicate  = "duplicate"
+
+	// FeedbackStatusQuarantined holds suspected spam. It is left out of
+	// listings unless asked for by status and never sent to webhooks.
+	FeedbackStatusQuarantined = "quarantined"
+)
+
+// FeedbackTransitions lists the statuses feedback may move to from each
+// status. Closed feedback can only be reopened by triaging it again.
+var FeedbackTransitions = map[string][]string{
+	FeedbackStatusNew:        {FeedbackStatusTriaged, FeedbackStatusInProgress, FeedbackStatusResolved, FeedbackStatusWontFix, FeedbackStatusDuplicate, FeedbackStatusQuarantined},
+	FeedbackStatusTriaged:    {FeedbackStatusInProgress, FeedbackStatusResolved, FeedbackStatusWontFix, FeedbackStatusDuplicate},
+	FeedbackStatusInProgress: {FeedbackStatusTriaged, FeedbackStatusResolved, FeedbackStatusWontFix, FeedbackStatusDuplicate},
+	FeedbackStatusResolved:   {FeedbackStatusTriaged, FeedbackStatusInProgress},
+	FeedbackStatusWontFix:    {FeedbackStatusTriaged},
+	FeedbackStatusDuplicate:  {FeedbackStatusTriaged},
+
+	FeedbackStatusQuarantined: {FeedbackStatusNew, FeedbackStatusWontFix, FeedbackStatusDuplicate},
+}
+
+func CanTransitionFeedback(from string, to string) bool {
+	for _, status := range FeedbackTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	FeedbackSortSubmitted = "submitted"
+	FeedbackSortRating    = "rating"
+	FeedbackSortID        = "id"
+)
+
 type TokenRequest struct {
 	Username string `json:"username"`
 	Hash     string `json:"hash"`
@@ -36,6 +310,401 @@ type Token struct {
 	Value string `json:"token"`
 }
 
+// DefaultSaveSlot is the slot read and written by the single-save endpoints.
+const DefaultSaveSlot = "default"
+
+type Save struct {
+	GameID      string     `json:"-" db:"game_id"`
+	AccountID   string     `json:"-" db:"account_id"`
+	Slot        string     `json:"slot" db:"slot"`
+	SaveState   string     `json:"save_state" db:"save_state"`
+	Signature   string     `json:"signature" db:"save_signature"`
+	SaveVersion string     `json:"save_version" db:"save_version"`
+	Updated     *time.Time `json:"updated" db:"updated"`
+}
+
+type SaveShare struct {
+	Code        string     `json:"code" db:"code"`
+	GameID      string     `json:"-" db:"game_id"`
+	AccountID   string     `json:"-" db:"account_id"`
+	Slot        string     `json:"slot" db:"slot"`
+	SaveState   string     `json:"-" db:"save_state"`
+	SaveVersion string     `json:"save_version" db:"save_version"`
+	SingleUse   bool       `json:"single_use" db:"single_use"`
+	Redeemed    int64      `json:"redeemed" db:"redeemed"`
+	Created     *time.Time `json:"created" db:"created"`
+	Expires     *time.Time `json:"expires" db:"expires"`
+}
+
+type ShareRequest struct {
+	ExpiresIn int64 `json:"expires_in"`
+	SingleUse bool  `json:"single_use"`
+}
+
+type SharingSettings struct {
+	Enabled bool `json:"enabled"`
+}
+
+type DeviceCode struct {
+	DeviceCode string     `json:"device_code" db:"device_code"`
+	UserCode   string     `json:"user_code" db:"user_code"`
+	AccountID  string     `json:"-" db:"account_id"`
+	Status     string     `json:"status" db:"status"`
+	Created    *time.Time `json:"created" db:"created"`
+	Expires    *time.Time `json:"expires" db:"expires"`
+	LastPolled *time.Time `json:"-" db:"last_polled"`
+}
+
+type DeviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Interval        int64  `json:"interval"`
+}
+
+type DeviceApprovalRequest struct {
+	UserCode string `json:"user_code"`
+}
+
+type DeviceTokenRequest struct {
+	DeviceCode string `json:"device_code"`
+}
+
+type SaveSignature struct {
+	Signature string `json:"signature"`
+}
+
+type SaveSchema struct {
+	GameID  string          `json:"-" db:"game_id"`
+	Version string          `json:"version" db:"version"`
+	Schema  json.RawMessage `json:"schema" db:"schema"`
+	Created *time.Time      `json:"created" db:"created"`
+}
+
+type SaveMigration struct {
+	GameID      string          `json:"-" db:"game_id"`
+	FromVersion string          `json:"from_version" db:"from_version"`
+	ToVersion   string          `json:"to_version" db:"to_version"`
+	Kind        string          `json:"kind" db:"kind"`
+	Definition  json.RawMessage `json:"definition" db:"definition"`
+	Created     *time.Time      `json:"created" db:"created"`
+}
+
+type SaveVerificationReport struct {
+	AccountID   string     `json:"account_id" db:"account_id"`
+	Username    string     `json:"username" db:"username"`
+	Failures    int64      `json:"failures" db:"failures"`
+	LastReason  string     `json:"last_reason" db:"last_reason"`
+	LastFailure *time.Time `json:"last_failure" db:"last_failure"`
+}
+
+type Survey struct {
+	ID          int64           `json:"id" db:"id"`
+	GameID      string          `json:"-" db:"game_id"`
+	Title       string          `json:"title" db:"title"`
+	Description string          `json:"description" db:"description"`
+	Build       string          `json:"build" db:"build"`
+	Status      string          `json:"status" db:"status"`
+	Questions   SurveyQuestions `json:"questions" db:"questions"`
+	Created     *time.Time      `json:"created" db:"created"`
+	Updated     *time.Time      `json:"updated" db:"updated"`
+}
+
+type SurveyQuestion struct {
+	ID       string   `json:"id"`
+	Type     string   `json:"type"`
+	Prompt   string   `json:"prompt"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options,omitempty"`
+	Min      int64    `json:"min,omitempty"`
+	Max      int64    `json:"max,omitempty"`
+}
+
+type SurveyQuestions []*SurveyQuestion
+
+func (q SurveyQuestions) Value() (driver.Value, error) {
+	return jsonValue(q)
+}
+
+func (q *SurveyQuestions) Scan(src interface{}) error {
+	*q = nil
+	return scanJSON(src, q)
+}
+
+// SurveyAnswers maps question IDs to answers: a number for scale questions, a
+// string for single choice and text, and a list of strings for multiple choice.
+type SurveyAnswers map[string]interface{}
+
+func (a SurveyAnswers) Value() (driver.Value, error) {
+	return jsonValue(a)
+}
+
+func (a *SurveyAnswers) Scan(src interface{}) error {
+	*a = nil
+	return scanJSON(src, a)
+}
+
+type SurveyResponse struct {
+	ID        int64         `json:"id" db:"id"`
+	SurveyID  int64         `json:"survey_id" db:"survey_id"`
+	AccountID *string       `json:"account_id" db:"account_id"`
+	Build     string        `json:"build" db:"build"`
+	Answers   SurveyAnswers `json:"answers" db:"answers"`
+	Submitted *time.Time    `json:"submitted" db:"submitted"`
+}
+
+type SurveyStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// SurveyAnswerCount is how many responses gave one answer to a question.
+// Each option picked in a multiple choice answer is counted separately.
+type SurveyAnswerCount struct {
+	QuestionID string `db:"question_id"`
+	Answer     string `db:"answer"`
+	Count      int64  `db:"count"`
+}
+
+type SurveyResults struct {
+	SurveyID  int64                   `json:"survey_id"`
+	Responses int64                   `json:"responses"`
+	Questions []*SurveyQuestionResult `json:"questions"`
+}
+
+type SurveyQuestionResult struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Prompt   string           `json:"prompt"`
+	Answered int64            `json:"answered"`
+	Average  *float64         `json:"average,omitempty"`
+	Counts   map[string]int64 `json:"counts,omitempty"`
+	Answers  []string         `json:"answers,omitempty"`
+}
+
+const (
+	SurveyStatusDraft     = "draft"
+	SurveyStatusPublished = "published"
+	SurveyStatusClosed    = "closed"
+
+	SurveyQuestionScale    = "scale"
+	SurveyQuestionSingle   = "single"
+	SurveyQuestionMultiple = "multiple"
+	SurveyQuestionText     = "text"
+)
+
+// WebhookDelivery is one event waiting in, or sent from, the webhook outbox.
+// Payload holds the event's data; notifiers format it when it is delivered.
+// Deliveries to a webhook subscription have SubscriptionID set.
+type WebhookDelivery struct {
+	ID             int64           `json:"id" db:"id"`
+	GameID         string          `json:"-" db:"game_id"`
+	Event          string          `json:"event" db:"event"`
+	Sink           string          `json:"sink" db:"sink"`
+	SubscriptionID *int64          `json:"subscription_id,omitempty" db:"subscription_id"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	NextAttempt    *time.Time      `json:"next_attempt" db:"next_attempt"`
+	LastStatus     *int            `json:"last_status" db:"last_status"`
+	LastError      *string         `json:"last_error" db:"last_error"`
+	Created        *time.Time      `json:"created" db:"created"`
+	Delivered      *time.Time      `json:"delivered" db:"delivered"`
+
+	// Traceparent is the W3C trace context of the request that queued the
+	// delivery, so sending it joins that request's trace.
+	Traceparent *string `json:"-" db:"traceparent"`
+
+	// The game's name and slug come along when a delivery is claimed, so
+	// messages can mention them.
+	GameName string `json:"-" db:"game_name"`
+	GameSlug string `json:"-" db:"game_slug"`
+}
+
+// UserRegisteredEvent is the payload of a user.registered event. It
+// deliberately leaves out the password hash and save.
+type UserRegisteredEvent struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// FeedbackStatusChangedEvent is the payload of a feedback.status_changed event.
+type FeedbackStatusChangedEvent struct {
+	FeedbackID  int64      `json:"feedback_id"`
+	FromStatus  string     `json:"from_status"`
+	ToStatus    string     `json:"to_status"`
+	DuplicateOf *int64     `json:"duplicate_of,omitempty"`
+	ChangedBy   string     `json:"changed_by"`
+	Changed     *time.Time `json:"changed"`
+}
+
+// SaveUpdatedEvent is the payload of a save.updated event. The save itself is
+// left out; subscribers that need it can fetch it.
+type SaveUpdatedEvent struct {
+	AccountID   string     `json:"account_id"`
+	Slot        string     `json:"slot"`
+	SaveVersion string     `json:"save_version"`
+	Updated     *time.Time `json:"updated"`
+}
+
+const (
+	WebhookEventFeedbackCreated       = "feedback.created"
+	WebhookEventFeedbackStatusChanged = "feedback.status_changed"
+	WebhookEventUserRegistered        = "user.registered"
+	WebhookEventSaveUpdated           = "save.updated"
+	WebhookEventFeedbackDigest        = "feedback.digest"
+
+	WebhookStatusPending   = "pending"
+	WebhookStatusDelivered = "delivered"
+	WebhookStatusDead      = "dead"
+
+	// WebhookSinkSubscription marks outbox rows bound for a subscription
+	// rather than a configured notifier.
+	WebhookSinkSubscription = "subscription"
+)
+
+// How a notifier receives an event: as it happens, or rolled up into a
+// digest of everything in the last hour or day.
+const (
+	DigestImmediate = "immediate"
+	DigestHourly    = "hourly"
+	DigestDaily     = "daily"
+)
+
+// FeedbackDigest is the payload of a feedback.digest event, summarising the
+// feedback submitted from From up to To. Quarantined feedback is left out.
+type FeedbackDigest struct {
+	Period        string              `json:"period"`
+	From          *time.Time          `json:"from"`
+	To            *time.Time          `json:"to"`
+	Count         int64               `json:"count" db:"count"`
+	AverageRating float64             `json:"average_rating" db:"average_rating"`
+	Types         []*FeedbackTypeStat `json:"types"`
+	Lowest        []*Feedback         `json:"lowest"`
+}
+
+// WebhookSubscription is a URL a developer registered to receive a game's
+// events. The secret is only shown when the subscription is created or its
+// secret rotated; while a rotation's grace period lasts, deliveries are signed
+// with the previous secret as well.
+type WebhookSubscription struct {
+	ID                    int64            `json:"id" db:"id"`
+	GameID                string           `json:"-" db:"game_id"`
+	URL                   string           `json:"url" db:"url"`
+	Events                WebhookEventList `json:"events" db:"events"`
+	Secret                string           `json:"secret,omitempty" db:"secret"`
+	PreviousSecret        *string          `json:"-" db:"previous_secret"`
+	PreviousSecretExpires *time.Time       `json:"previous_secret_expires,omitempty" db:"previous_secret_expires"`
+	Active                bool             `json:"active" db:"active"`
+	CreatedBy             *string          `json:"created_by" db:"created_by"`
+	Created               *time.Time       `json:"created" db:"created"`
+	Updated               *time.Time       `json:"updated" db:"updated"`
+}
+
+// WebhookEventList is the events a subscription wants, stored as JSONB.
+type WebhookEventList []string
+
+func (l WebhookEventList) Value() (driver.Value, error) {
+	return jsonValue(l)
+}
+
+func (l *WebhookEventList) Scan(src interface{}) error {
+	return scanJSON(src, l)
+}
+
+type WebhookSubscriptionRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+type WebhookSecretRotationRequest struct {
+	// Grace is how many seconds the old secret keeps signing deliveries.
+	Grace *int64 `json:"grace"`
+}
+
+// WebhookAttempt is one try at sending a delivery, kept as its delivery log.
+type WebhookAttempt struct {
+	ID         int64      `json:"id" db:"id"`
+	DeliveryID int64      `json:"delivery_id" db:"delivery_id"`
+	Attempted  *time.Time `json:"attempted" db:"attempted"`
+	Status     *int       `json:"status" db:"status"`
+	Error      *string    `json:"error" db:"error"`
+	DurationMS int64      `json:"duration_ms" db:"duration_ms"`
+}
+
+// WebhookBacklog is how far behind the dispatcher is. Due deliveries are the
+// pending ones whose next attempt has come.
+type WebhookBacklog struct {
+	Pending   int64      `json:"pending" db:"pending"`
+	Due       int64      `json:"due" db:"due"`
+	OldestDue *time.Time `json:"oldest_due" db:"oldest_due"`
+}
+
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusDegraded    = "degraded"
+	HealthStatusUnavailable = "unavailable"
+)
+
+// Readiness is the readyz report: an overall status and one check per
+// dependency. Only unavailable checks make the API unready.
+type Readiness struct {
+	Status string                  `json:"status"`
+	Checks map[string]*HealthCheck `json:"checks"`
+}
+
+// HealthCheck is the state of one dependency. Fields a check doesn't use are
+// left out.
+type HealthCheck struct {
+	Status          string          `json:"status"`
+	Error           string          `json:"error,omitempty"`
+	LatencyMS       *int64          `json:"latency_ms,omitempty"`
+	Version         *int64          `json:"version,omitempty"`
+	ExpectedVersion *int64          `json:"expected_version,omitempty"`
+	Dirty           *bool           `json:"dirty,omitempty"`
+	Backlog         *WebhookBacklog `json:"backlog,omitempty"`
+}
+
+// TemplatePreviewRequest asks for an event to be rendered without sending it.
+// Give either a notifier, to see its configured message, or templates to try
+// out. Data replaces the sample payload.
+type TemplatePreviewRequest struct {
+	Event    string          `json:"event"`
+	Notifier string          `json:"notifier"`
+	Title    string          `json:"title"`
+	Text     string          `json:"text"`
+	URL      string          `json:"url"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// WebhookEvents lists every event notifiers and subscriptions can receive.
+// Digests are only sent to notifiers, which ask for them per event rather
+// than listing feedback.digest.
+var WebhookEvents = []string{
+	WebhookEventFeedbackCreated,
+	WebhookEventFeedbackStatusChanged,
+	WebhookEventUserRegistered,
+	WebhookEventSaveUpdated,
+	WebhookEventFeedbackDigest,
+}
+
+func IsWebhookEvent(event string) bool {
+	for _, known := range WebhookEvents {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	DeviceCodePending  = "PENDING"
+	DeviceCodeApproved = "APPROVED"
+	DeviceCodeDenied   = "DENIED"
+	DeviceCodeConsumed = "CONSUMED"
+)
+
 var (
 	UserRole = Role{
 		Name:         "USER",
@@ -0,0 +1,2 @@
+DROP INDEX feedback_search_index;
+ALTER TABLE feedback DROP COLUMN search;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE feedback
+    ADD COLUMN search TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', COALESCE(description, ''))) STORED;
+
+CREATE INDEX feedback_search_index ON feedback USING GIN (search);
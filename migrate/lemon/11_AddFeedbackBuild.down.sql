@@ -0,0 +1,2 @@
+DROP INDEX feedback_game_build_index;
+ALTER TABLE feedback DROP COLUMN build;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE feedback ADD COLUMN build VARCHAR;
+
+CREATE INDEX feedback_game_build_index ON feedback (game_id, build, submitted);
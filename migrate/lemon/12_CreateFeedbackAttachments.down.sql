@@ -0,0 +1 @@
+DROP TABLE feedback_attachments;
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE feedback_attachments (
+    id SERIAL PRIMARY KEY,
+    feedback_id INT NOT NULL REFERENCES feedback (id) ON DELETE CASCADE,
+    filename VARCHAR NOT NULL,
+    content_type VARCHAR NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key VARCHAR NOT NULL UNIQUE,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX feedback_attachments_feedback_index ON feedback_attachments (feedback_id, id);
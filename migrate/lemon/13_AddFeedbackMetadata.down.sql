@@ -0,0 +1,2 @@
+DROP INDEX feedback_metadata_index;
+ALTER TABLE feedback DROP COLUMN metadata;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE feedback ADD COLUMN metadata JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX feedback_metadata_index ON feedback USING GIN (metadata jsonb_path_ops);
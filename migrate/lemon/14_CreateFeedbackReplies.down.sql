@@ -0,0 +1,3 @@
+DROP TABLE feedback_replies;
+DROP INDEX feedback_account_index;
+ALTER TABLE feedback DROP COLUMN account_id;
\ No newline at end of file
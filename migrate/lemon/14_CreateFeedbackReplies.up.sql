@@ -0,0 +1,15 @@
+ALTER TABLE feedback ADD COLUMN account_id VARCHAR(36) REFERENCES usertable (id) ON DELETE SET NULL;
+
+CREATE INDEX feedback_account_index ON feedback (game_id, account_id, submitted);
+
+CREATE TABLE feedback_replies (
+    id SERIAL PRIMARY KEY,
+    feedback_id INT NOT NULL REFERENCES feedback (id) ON DELETE CASCADE,
+    author_id VARCHAR(36) REFERENCES usertable (id) ON DELETE SET NULL,
+    from_developer BOOLEAN NOT NULL,
+    body VARCHAR NOT NULL,
+    player_read BOOLEAN NOT NULL DEFAULT false,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX feedback_replies_feedback_index ON feedback_replies (feedback_id, created);
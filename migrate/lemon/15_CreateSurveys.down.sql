@@ -0,0 +1,2 @@
+DROP TABLE survey_responses;
+DROP TABLE surveys;
\ No newline at end of file
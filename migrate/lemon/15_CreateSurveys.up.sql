@@ -0,0 +1,24 @@
+CREATE TABLE surveys (
+    id SERIAL PRIMARY KEY,
+    game_id VARCHAR(36) NOT NULL REFERENCES games (id) ON DELETE CASCADE,
+    title VARCHAR NOT NULL,
+    description VARCHAR NOT NULL DEFAULT '',
+    build VARCHAR,
+    status VARCHAR NOT NULL DEFAULT 'draft',
+    questions JSONB NOT NULL,
+    created TIMESTAMP NOT NULL,
+    updated TIMESTAMP NOT NULL
+);
+
+CREATE INDEX surveys_game_status_index ON surveys (game_id, status, build);
+
+CREATE TABLE survey_responses (
+    id SERIAL PRIMARY KEY,
+    survey_id INT NOT NULL REFERENCES surveys (id) ON DELETE CASCADE,
+    account_id VARCHAR(36) REFERENCES usertable (id) ON DELETE SET NULL,
+    build VARCHAR,
+    answers JSONB NOT NULL,
+    submitted TIMESTAMP NOT NULL
+);
+
+CREATE INDEX survey_responses_survey_index ON survey_responses (survey_id, build);
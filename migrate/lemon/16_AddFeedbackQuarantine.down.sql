@@ -0,0 +1,2 @@
+DROP INDEX feedback_game_recent_index;
+ALTER TABLE feedback DROP COLUMN quarantine_reason;
\ No newline at end of file
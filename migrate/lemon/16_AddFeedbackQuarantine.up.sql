@@ -0,0 +1,3 @@
+ALTER TABLE feedback ADD COLUMN quarantine_reason VARCHAR;
+
+CREATE INDEX feedback_game_recent_index ON feedback (game_id, submitted) WHERE description IS NOT NULL AND description <> '';
@@ -0,0 +1 @@
+DROP TABLE webhook_outbox;
\ No newline at end of file
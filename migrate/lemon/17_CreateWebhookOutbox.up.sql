@@ -0,0 +1,17 @@
+CREATE TABLE webhook_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    game_id VARCHAR(36) NOT NULL REFERENCES games (id) ON DELETE CASCADE,
+    event VARCHAR NOT NULL,
+    sink VARCHAR NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt TIMESTAMP NOT NULL,
+    last_status INT,
+    last_error VARCHAR,
+    created TIMESTAMP NOT NULL,
+    delivered TIMESTAMP
+);
+
+CREATE INDEX webhook_outbox_pending_index ON webhook_outbox (next_attempt) WHERE status = 'pending';
+CREATE INDEX webhook_outbox_game_status_index ON webhook_outbox (game_id, status, created);
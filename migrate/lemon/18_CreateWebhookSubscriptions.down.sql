@@ -0,0 +1,7 @@
+UPDATE webhook_outbox SET event = 'user.created' WHERE event = 'user.registered';
+
+DROP TABLE webhook_attempts;
+
+ALTER TABLE webhook_outbox DROP COLUMN subscription_id;
+
+DROP TABLE webhook_subscriptions;
@@ -0,0 +1,32 @@
+CREATE TABLE webhook_subscriptions (
+    id BIGSERIAL PRIMARY KEY,
+    game_id VARCHAR(36) NOT NULL REFERENCES games (id) ON DELETE CASCADE,
+    url VARCHAR NOT NULL,
+    events JSONB NOT NULL,
+    secret VARCHAR NOT NULL,
+    previous_secret VARCHAR,
+    previous_secret_expires TIMESTAMP,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by VARCHAR(36) REFERENCES usertable (id) ON DELETE SET NULL,
+    created TIMESTAMP NOT NULL,
+    updated TIMESTAMP NOT NULL
+);
+
+CREATE INDEX webhook_subscriptions_game_index ON webhook_subscriptions (game_id) WHERE active;
+
+ALTER TABLE webhook_outbox ADD COLUMN subscription_id BIGINT REFERENCES webhook_subscriptions (id) ON DELETE CASCADE;
+
+CREATE INDEX webhook_outbox_subscription_index ON webhook_outbox (subscription_id, created) WHERE subscription_id IS NOT NULL;
+
+CREATE TABLE webhook_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id BIGINT NOT NULL REFERENCES webhook_outbox (id) ON DELETE CASCADE,
+    attempted TIMESTAMP NOT NULL,
+    status INT,
+    error VARCHAR,
+    duration_ms BIGINT NOT NULL
+);
+
+CREATE INDEX webhook_attempts_delivery_index ON webhook_attempts (delivery_id, attempted);
+
+UPDATE webhook_outbox SET event = 'user.registered' WHERE event = 'user.created';
@@ -0,0 +1,3 @@
+DROP INDEX feedback_submitted_index;
+
+DROP TABLE feedback_digests;
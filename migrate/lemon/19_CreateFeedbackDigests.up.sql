@@ -0,0 +1,11 @@
+CREATE TABLE feedback_digests (
+    id BIGSERIAL PRIMARY KEY,
+    game_id VARCHAR(36) NOT NULL REFERENCES games (id) ON DELETE CASCADE,
+    period VARCHAR NOT NULL,
+    period_start TIMESTAMP NOT NULL,
+    period_end TIMESTAMP NOT NULL,
+    created TIMESTAMP NOT NULL,
+    UNIQUE (game_id, period, period_start)
+);
+
+CREATE INDEX feedback_submitted_index ON feedback (submitted);
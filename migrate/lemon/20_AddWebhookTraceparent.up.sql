@@ -0,0 +1 @@
+ALTER TABLE webhook_outbox ADD COLUMN traceparent VARCHAR;
@@ -0,0 +1,3 @@
+DROP INDEX save_verification_failures_account_index;
+DROP TABLE save_verification_failures;
+ALTER TABLE usertable DROP COLUMN save_signature;
\ No newline at end of file
@@ -0,0 +1,10 @@
+ALTER TABLE usertable ADD COLUMN save_signature VARCHAR;
+
+CREATE TABLE save_verification_failures (
+    id SERIAL PRIMARY KEY,
+    account_id VARCHAR(36) NOT NULL REFERENCES usertable (id) ON DELETE CASCADE,
+    reason VARCHAR NOT NULL,
+    submitted TIMESTAMP NOT NULL
+);
+
+CREATE INDEX save_verification_failures_account_index ON save_verification_failures (account_id);
@@ -0,0 +1,3 @@
+DROP TABLE save_migrations;
+DROP TABLE save_schemas;
+ALTER TABLE usertable DROP COLUMN save_version;
\ No newline at end of file
@@ -0,0 +1,15 @@
+ALTER TABLE usertable ADD COLUMN save_version VARCHAR;
+
+CREATE TABLE save_schemas (
+    version VARCHAR PRIMARY KEY,
+    schema JSONB NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE TABLE save_migrations (
+    from_version VARCHAR PRIMARY KEY,
+    to_version VARCHAR NOT NULL,
+    kind VARCHAR NOT NULL,
+    definition JSONB NOT NULL,
+    created TIMESTAMP NOT NULL
+);
@@ -0,0 +1,17 @@
+DROP TABLE settings;
+DROP INDEX save_shares_account_index;
+DROP TABLE save_shares;
+
+ALTER TABLE usertable
+    ADD COLUMN save_state VARCHAR,
+    ADD COLUMN save_signature VARCHAR,
+    ADD COLUMN save_version VARCHAR;
+
+UPDATE usertable u
+SET save_state = s.save_state,
+    save_signature = s.save_signature,
+    save_version = s.save_version
+FROM saves s
+WHERE s.account_id = u.id AND s.slot = 'default';
+
+DROP TABLE saves;
@@ -0,0 +1,39 @@
+CREATE TABLE saves (
+    account_id VARCHAR(36) NOT NULL REFERENCES usertable (id) ON DELETE CASCADE,
+    slot VARCHAR NOT NULL,
+    save_state VARCHAR,
+    save_signature VARCHAR,
+    save_version VARCHAR,
+    updated TIMESTAMP NOT NULL,
+    PRIMARY KEY (account_id, slot)
+);
+
+INSERT INTO saves (account_id, slot, save_state, save_signature, save_version, updated)
+SELECT id, 'default', save_state, save_signature, save_version, NOW() AT TIME ZONE 'utc'
+FROM usertable;
+
+ALTER TABLE usertable
+    DROP COLUMN save_state,
+    DROP COLUMN save_signature,
+    DROP COLUMN save_version;
+
+CREATE TABLE save_shares (
+    code VARCHAR(16) PRIMARY KEY,
+    account_id VARCHAR(36) NOT NULL REFERENCES usertable (id) ON DELETE CASCADE,
+    slot VARCHAR NOT NULL,
+    save_state VARCHAR,
+    save_version VARCHAR,
+    single_use BOOLEAN NOT NULL DEFAULT false,
+    redeemed INT NOT NULL DEFAULT 0,
+    created TIMESTAMP NOT NULL,
+    expires TIMESTAMP NOT NULL
+);
+
+CREATE INDEX save_shares_account_index ON save_shares (account_id);
+
+CREATE TABLE settings (
+    name VARCHAR PRIMARY KEY,
+    value VARCHAR NOT NULL
+);
+
+INSERT INTO settings (name, value) VALUES ('save_sharing_enabled', 'true');
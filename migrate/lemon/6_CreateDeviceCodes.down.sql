@@ -0,0 +1,2 @@
+DROP INDEX device_codes_expires_index;
+DROP TABLE device_codes;
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE device_codes (
+    device_code VARCHAR(36) PRIMARY KEY,
+    user_code VARCHAR(16) UNIQUE NOT NULL,
+    account_id VARCHAR(36) REFERENCES usertable (id) ON DELETE CASCADE,
+    status VARCHAR NOT NULL,
+    created TIMESTAMP NOT NULL,
+    expires TIMESTAMP NOT NULL,
+    last_polled TIMESTAMP
+);
+
+CREATE INDEX device_codes_expires_index ON device_codes (expires);
@@ -0,0 +1,33 @@
+CREATE TABLE settings (
+    name VARCHAR PRIMARY KEY,
+    value VARCHAR NOT NULL
+);
+
+INSERT INTO settings (name, value)
+SELECT 'save_sharing_enabled', sharing_enabled::VARCHAR FROM games WHERE slug = 'gamejam';
+
+DELETE FROM save_verification_failures WHERE game_id <> (SELECT id FROM games WHERE slug = 'gamejam');
+ALTER TABLE save_verification_failures DROP COLUMN game_id;
+
+DELETE FROM save_migrations WHERE game_id <> (SELECT id FROM games WHERE slug = 'gamejam');
+ALTER TABLE save_migrations DROP CONSTRAINT save_migrations_pkey, ADD PRIMARY KEY (from_version);
+ALTER TABLE save_migrations DROP COLUMN game_id;
+
+DELETE FROM save_schemas WHERE game_id <> (SELECT id FROM games WHERE slug = 'gamejam');
+ALTER TABLE save_schemas DROP CONSTRAINT save_schemas_pkey, ADD PRIMARY KEY (version);
+ALTER TABLE save_schemas DROP COLUMN game_id;
+
+DELETE FROM save_shares WHERE game_id <> (SELECT id FROM games WHERE slug = 'gamejam');
+ALTER TABLE save_shares DROP COLUMN game_id;
+
+DELETE FROM saves WHERE game_id <> (SELECT id FROM games WHERE slug = 'gamejam');
+ALTER TABLE saves DROP CONSTRAINT saves_pkey, ADD PRIMARY KEY (account_id, slot);
+ALTER TABLE saves DROP COLUMN game_id;
+
+DROP INDEX feedback_game_index;
+DELETE FROM feedback WHERE game_id <> (SELECT id FROM games WHERE slug = 'gamejam');
+ALTER TABLE feedback DROP COLUMN game_id;
+
+DROP INDEX game_developers_account_index;
+DROP TABLE game_developers;
+DROP TABLE games;
@@ -0,0 +1,59 @@
+CREATE TABLE games (
+    id VARCHAR(36) PRIMARY KEY,
+    slug VARCHAR UNIQUE NOT NULL,
+    name VARCHAR NOT NULL,
+    api_key VARCHAR UNIQUE NOT NULL,
+    sharing_enabled BOOLEAN NOT NULL DEFAULT true,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE TABLE game_developers (
+    game_id VARCHAR(36) NOT NULL REFERENCES games (id) ON DELETE CASCADE,
+    account_id VARCHAR(36) NOT NULL REFERENCES usertable (id) ON DELETE CASCADE,
+    PRIMARY KEY (game_id, account_id)
+);
+
+CREATE INDEX game_developers_account_index ON game_developers (account_id);
+
+-- Everything that existed before tenancy belongs to the original jam game.
+INSERT INTO games (id, slug, name, api_key, sharing_enabled, created)
+SELECT
+    gen_random_uuid()::VARCHAR,
+    'gamejam',
+    'Gamejam',
+    encode(gen_random_bytes(24), 'hex'),
+    COALESCE((SELECT value::BOOLEAN FROM settings WHERE name = 'save_sharing_enabled'), true),
+    NOW() AT TIME ZONE 'utc';
+
+INSERT INTO game_developers (game_id, account_id)
+SELECT g.id, u.id FROM games g, usertable u WHERE g.slug = 'gamejam' AND u.role = 'DEVELOPER';
+
+DROP TABLE settings;
+
+ALTER TABLE feedback ADD COLUMN game_id VARCHAR(36) REFERENCES games (id) ON DELETE CASCADE;
+UPDATE feedback SET game_id = (SELECT id FROM games WHERE slug = 'gamejam');
+ALTER TABLE feedback ALTER COLUMN game_id SET NOT NULL;
+CREATE INDEX feedback_game_index ON feedback (game_id, id);
+
+ALTER TABLE saves ADD COLUMN game_id VARCHAR(36) REFERENCES games (id) ON DELETE CASCADE;
+UPDATE saves SET game_id = (SELECT id FROM games WHERE slug = 'gamejam');
+ALTER TABLE saves ALTER COLUMN game_id SET NOT NULL;
+ALTER TABLE saves DROP CONSTRAINT saves_pkey, ADD PRIMARY KEY (game_id, account_id, slot);
+
+ALTER TABLE save_shares ADD COLUMN game_id VARCHAR(36) REFERENCES games (id) ON DELETE CASCADE;
+UPDATE save_shares SET game_id = (SELECT id FROM games WHERE slug = 'gamejam');
+ALTER TABLE save_shares ALTER COLUMN game_id SET NOT NULL;
+
+ALTER TABLE save_schemas ADD COLUMN game_id VARCHAR(36) REFERENCES games (id) ON DELETE CASCADE;
+UPDATE save_schemas SET game_id = (SELECT id FROM games WHERE slug = 'gamejam');
+ALTER TABLE save_schemas ALTER COLUMN game_id SET NOT NULL;
+ALTER TABLE save_schemas DROP CONSTRAINT save_schemas_pkey, ADD PRIMARY KEY (game_id, version);
+
+ALTER TABLE save_migrations ADD COLUMN game_id VARCHAR(36) REFERENCES games (id) ON DELETE CASCADE;
+UPDATE save_migrations SET game_id = (SELECT id FROM games WHERE slug = 'gamejam');
+ALTER TABLE save_migrations ALTER COLUMN game_id SET NOT NULL;
+ALTER TABLE save_migrations DROP CONSTRAINT save_migrations_pkey, ADD PRIMARY KEY (game_id, from_version);
+
+ALTER TABLE save_verification_failures ADD COLUMN game_id VARCHAR(36) REFERENCES games (id) ON DELETE CASCADE;
+UPDATE save_verification_failures SET game_id = (SELECT id FROM games WHERE slug = 'gamejam');
+ALTER TABLE save_verification_failures ALTER COLUMN game_id SET NOT NULL;
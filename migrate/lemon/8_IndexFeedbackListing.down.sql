@@ -0,0 +1,5 @@
+DROP INDEX feedback_game_type_index;
+DROP INDEX feedback_game_rating_index;
+DROP INDEX feedback_game_submitted_index;
+
+ALTER TABLE feedback ALTER COLUMN submitted DROP NOT NULL;
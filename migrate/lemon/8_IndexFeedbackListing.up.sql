@@ -0,0 +1,6 @@
+UPDATE feedback SET submitted = NOW() AT TIME ZONE 'utc' WHERE submitted IS NULL;
+ALTER TABLE feedback ALTER COLUMN submitted SET NOT NULL;
+
+CREATE INDEX feedback_game_submitted_index ON feedback (game_id, submitted, id);
+CREATE INDEX feedback_game_rating_index ON feedback (game_id, rating, id);
+CREATE INDEX feedback_game_type_index ON feedback (game_id, type, submitted);
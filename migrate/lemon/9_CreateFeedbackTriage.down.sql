@@ -0,0 +1,10 @@
+DROP INDEX feedback_status_history_feedback_index;
+DROP TABLE feedback_status_history;
+DROP INDEX feedback_notes_feedback_index;
+DROP TABLE feedback_notes;
+DROP INDEX feedback_game_status_index;
+
+ALTER TABLE feedback
+    DROP COLUMN duplicate_of,
+    DROP COLUMN assignee_id,
+    DROP COLUMN status;
@@ -0,0 +1,29 @@
+ALTER TABLE feedback
+    ADD COLUMN status VARCHAR NOT NULL DEFAULT 'new',
+    ADD COLUMN assignee_id VARCHAR(36) REFERENCES usertable (id) ON DELETE SET NULL,
+    ADD COLUMN duplicate_of INT REFERENCES feedback (id) ON DELETE SET NULL;
+
+UPDATE feedback SET status = 'triaged' WHERE read;
+
+CREATE INDEX feedback_game_status_index ON feedback (game_id, status, submitted);
+
+CREATE TABLE feedback_notes (
+    id SERIAL PRIMARY KEY,
+    feedback_id INT NOT NULL REFERENCES feedback (id) ON DELETE CASCADE,
+    author_id VARCHAR(36) REFERENCES usertable (id) ON DELETE SET NULL,
+    body VARCHAR NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX feedback_notes_feedback_index ON feedback_notes (feedback_id, created);
+
+CREATE TABLE feedback_status_history (
+    id SERIAL PRIMARY KEY,
+    feedback_id INT NOT NULL REFERENCES feedback (id) ON DELETE CASCADE,
+    from_status VARCHAR NOT NULL,
+    to_status VARCHAR NOT NULL,
+    changed_by VARCHAR(36) REFERENCES usertable (id) ON DELETE SET NULL,
+    changed TIMESTAMP NOT NULL
+);
+
+CREATE INDEX feedback_status_history_feedback_index ON feedback_status_history (feedback_id, changed);
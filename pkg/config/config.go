@@ -12,7 +12,21 @@ var (
 )
 
 type APIConfig struct {
-	Port int `json:"port"`
+	Port        int    `json:"port"`
+	DefaultGame string `json:"default_game"`
+
+	// Timeouts for the HTTP server, in seconds. Anything left at zero gets a
+	// default; WriteTimeout bounds how long a feedback export may stream.
+	ReadTimeout       int64 `json:"read_timeout"`
+	ReadHeaderTimeout int64 `json:"read_header_timeout"`
+	WriteTimeout      int64 `json:"write_timeout"`
+	IdleTimeout       int64 `json:"idle_timeout"`
+	// ShutdownTimeout is how long requests in flight get to finish once the
+	// server is asked to stop.
+	ShutdownTimeout int64 `json:"shutdown_timeout"`
+	// DegradedMode starts the server even if the database can't be reached,
+	// answering 503 until it can.
+	DegradedMode bool `json:"degraded_mode"`
 }
 
 type DatabaseConfig struct {
@@ -22,12 +36,22 @@ type DatabaseConfig struct {
 	Database      string `json:"database"`
 	Port          int64  `json:"port"`
 	EncryptionKey string `json:"encryption_key"`
+	// StartupTimeout is how many seconds startup keeps retrying the database
+	// before giving up.
+	StartupTimeout int64 `json:"startup_timeout"`
 }
 type SecurityConfig struct {
 	Secret   string `json:"secret"`
 	Salt     string `json:"salt"`
 	Redirect string `json:"redirect"`
 	Enforce  bool   `json:"enforce"`
+	SaveKey  string `json:"save_key"`
+
+	// RequireSignedSaves rejects uploads that don't carry the signature the
+	// server issued for the save currently stored in that slot, proving the
+	// client started from it. A slot with nothing stored takes any save.
+	RequireSignedSaves bool   `json:"require_signed_saves"`
+	DeviceVerifyURL    string `json:"device_verify_url"`
 }
 
 type Databases struct {
@@ -35,15 +59,105 @@ type Databases struct {
 }
 
 type Webhooks struct {
-	FeedbackURL string `json:"discord-feedback"`
-	NewUserURL  string `json:"discord-new-user"`
+	FeedbackURL  string                      `json:"discord-feedback"`
+	NewUserURL   string                      `json:"discord-new-user"`
+	MaxAttempts  int                         `json:"max_attempts"`
+	PollInterval int64                       `json:"poll_interval"`
+	SiteURL      string                      `json:"site_url"`
+	Notifiers    map[string]*NotifierConfig  `json:"notifiers"`
+	Templates    map[string]*MessageTemplate `json:"templates"`
+
+	// AllowPrivateURLs lets subscriptions use plain http and reach private
+	// and loopback addresses, for local development.
+	AllowPrivateURLs bool `json:"allow_private_urls"`
+	// SecretGrace is how many seconds a rotated subscription secret keeps
+	// signing deliveries, unless the rotation asks for something else.
+	SecretGrace int64 `json:"secret_grace"`
+}
+
+// MessageTemplate holds text/templates for the parts of a notification. The
+// title and text can be read from a file instead; inline templates win.
+type MessageTemplate struct {
+	Title     string `json:"title"`
+	Text      string `json:"text"`
+	URL       string `json:"url"`
+	TitleFile string `json:"title_file"`
+	TextFile  string `json:"text_file"`
+}
+
+// NotifierConfig describes one place notifications are sent. Type picks the
+// implementation (discord, slack, json or smtp) and decides which of the
+// other fields apply.
+type NotifierConfig struct {
+	Type    string            `json:"type"`
+	Events  []string          `json:"events"`
+	URL     string            `json:"url"`
+	Name    string            `json:"name"`
+	IconURL string            `json:"icon_url"`
+	Headers map[string]string `json:"headers"`
+
+	// Templates override the message for some events, keyed by event.
+	Templates map[string]*MessageTemplate `json:"templates"`
+	// Digests picks, per event, whether it is sent immediately or rolled
+	// into an hourly or daily digest. Only feedback.created has digests.
+	Digests map[string]string `json:"digests"`
+
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+type StorageConfig struct {
+	Driver    string `json:"driver"`
+	Path      string `json:"path"`
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+}
+
+type AttachmentConfig struct {
+	MaxSize      int64    `json:"max_size"`
+	MaxFiles     int      `json:"max_files"`
+	AllowedTypes []string `json:"allowed_types"`
+	URLExpiry    int64    `json:"url_expiry"`
+}
+
+type SpamConfig struct {
+	Blocklist          []string `json:"blocklist"`
+	BlockPatterns      []string `json:"block_patterns"`
+	MaxLinks           int      `json:"max_links"`
+	DuplicateThreshold float64  `json:"duplicate_threshold"`
+	DuplicateWindow    int64    `json:"duplicate_window"`
+}
+
+// TracingConfig picks where OpenTelemetry spans go. Exporter is none, stdout
+// or otlp; otlp posts to Endpoint (host:port, localhost:4318 by default) over
+// HTTP, with Headers for any collector authentication.
+type TracingConfig struct {
+	Exporter    string            `json:"exporter"`
+	Endpoint    string            `json:"endpoint"`
+	Insecure    bool              `json:"insecure"`
+	Headers     map[string]string `json:"headers"`
+	ServiceName string            `json:"service_name"`
+	// SampleRatio is the share of new traces recorded, from 0 to 1. Zero
+	// records them all. Traces started upstream keep their own decision.
+	SampleRatio float64 `json:"sample_ratio"`
 }
 
 type Config struct {
-	API       *APIConfig      `json:"api"`
-	Databases *Databases      `json:"databases"`
-	Security  *SecurityConfig `json:"security"`
-	Webhooks  *Webhooks       `json:"webhooks"`
+	API         *APIConfig        `json:"api"`
+	Databases   *Databases        `json:"databases"`
+	Security    *SecurityConfig   `json:"security"`
+	Webhooks    *Webhooks         `json:"webhooks"`
+	Storage     *StorageConfig    `json:"storage"`
+	Attachments *AttachmentConfig `json:"attachments"`
+	Spam        *SpamConfig       `json:"spam"`
+	Tracing     *TracingConfig    `json:"tracing"`
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -0,0 +1,148 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	lemon_api "lemon/lemon-api"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// FeedbackWriter writes feedback one row at a time in an export format.
+// Flush must be called once every row has been written.
+type FeedbackWriter interface {
+	Write(feedback *lemon_api.Feedback) error
+	Flush() error
+}
+
+// NewFeedbackWriter returns a writer for the named format.
+func NewFeedbackWriter(format string, w io.Writer) (FeedbackWriter, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatNDJSON:
+		return &ndjsonWriter{encoder: json.NewEncoder(w)}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// ContentType is the media type to serve an export format with.
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv"
+	}
+	return "application/x-ndjson"
+}
+
+var csvHeader = []string{
+	"id",
+	"submitted",
+	"rating",
+	"type",
+	"status",
+	"read",
+	"build",
+	"platform",
+	"locale",
+	"scene",
+	"session_id",
+	"account_id",
+	"assignee_id",
+	"duplicate_of",
+	"description",
+	"context",
+}
+
+type csvWriter struct {
+	out *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	out := csv.NewWriter(w)
+	if err := out.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return &csvWriter{out: out}, nil
+}
+
+func (w *csvWriter) Write(feedback *lemon_api.Feedback) error {
+	submitted := ""
+	if feedback.Submitted != nil {
+		submitted = feedback.Submitted.UTC().Format(time.RFC3339)
+	}
+	duplicateOf := ""
+	if feedback.DuplicateOf != nil {
+		duplicateOf = strconv.FormatInt(*feedback.DuplicateOf, 10)
+	}
+	context := ""
+	if len(feedback.Metadata.Context) > 0 {
+		b, err := json.Marshal(feedback.Metadata.Context)
+		if err != nil {
+			return err
+		}
+		context = string(b)
+	}
+
+	return w.out.Write([]string{
+		strconv.FormatInt(feedback.ID, 10),
+		submitted,
+		strconv.FormatInt(feedback.Rating, 10),
+		cell(feedback.Type),
+		feedback.Status,
+		strconv.FormatBool(feedback.Read),
+		cell(feedback.Build),
+		cell(feedback.Metadata.Platform),
+		cell(feedback.Metadata.Locale),
+		cell(feedback.Metadata.Scene),
+		cell(feedback.Metadata.SessionID),
+		stringValue(feedback.AccountID),
+		stringValue(feedback.AssigneeID),
+		duplicateOf,
+		cell(feedback.Description),
+		cell(context),
+	})
+}
+
+func (w *csvWriter) Flush() error {
+	w.out.Flush()
+	return w.out.Error()
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(feedback *lemon_api.Feedback) error {
+	return w.encoder.Encode(feedback)
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return nil
+}
+
+// cell stops spreadsheets from treating text players wrote as a formula.
+func cell(value string) string {
+	if value != "" && strings.ContainsAny(value[:1], "=+-@\t\r") {
+		return "'" + value
+	}
+	return value
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
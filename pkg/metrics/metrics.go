@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "lemon"
+
+// Outcomes used as label values.
+const (
+	OutcomeSuccess     = "success"
+	OutcomeFailure     = "failure"
+	OutcomeAccepted    = "accepted"
+	OutcomeQuarantined = "quarantined"
+	OutcomeDelivered   = "delivered"
+	OutcomeRetry       = "retry"
+	OutcomeDead        = "dead"
+)
+
+// Registry holds every lemon metric along with the Go runtime and process
+// collectors. It is what the /metrics endpoint serves.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "How long HTTP requests took to serve, by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "How long database statements took, by statement and whether they failed.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"statement", "outcome"})
+
+	webhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts, by sink, event and outcome.",
+	}, []string{"sink", "event", "outcome"})
+
+	webhookDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "webhook_delivery_duration_seconds",
+		Help:      "How long webhook delivery attempts took, by sink.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"sink"})
+
+	// Registrations counts new player accounts.
+	Registrations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Player accounts registered.",
+	})
+
+	// Logins counts login attempts by outcome.
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts, by outcome.",
+	}, []string{"outcome"})
+
+	// FeedbackSubmissions counts stored feedback, accepted or quarantined.
+	FeedbackSubmissions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "feedback_submissions_total",
+		Help:      "Feedback stored, by whether it was accepted or quarantined.",
+	}, []string{"outcome"})
+
+	// SaveUploads counts saves players uploaded.
+	SaveUploads = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "save_uploads_total",
+		Help:      "Saves uploaded by players.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		queryDuration,
+		webhookDeliveries,
+		webhookDuration,
+		Registrations,
+		Logins,
+		FeedbackSubmissions,
+		SaveUploads,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records the count, status and latency of every request. Routes
+// are labelled by their pattern, such as /api/games/:game/feedback, so IDs in
+// paths don't each become a series.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(started).Seconds())
+	}
+}
+
+// RegisterDB exports the connection pool statistics of db. Only the first
+// database registered is kept.
+func RegisterDB(db *sql.DB, name string) {
+	Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveQuery records how long a database statement took.
+func ObserveQuery(statement string, duration time.Duration, err error) {
+	queryDuration.WithLabelValues(statement, outcome(err)).Observe(duration.Seconds())
+}
+
+// ObserveWebhook records a webhook delivery attempt.
+func ObserveWebhook(sink string, event string, outcome string, duration time.Duration) {
+	webhookDeliveries.WithLabelValues(sink, event, outcome).Inc()
+	webhookDuration.WithLabelValues(sink).Observe(duration.Seconds())
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"sort"
+
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/config"
+
+	"github.com/pkg/errors"
+)
+
+// digestEvents are the events that can be rolled into a digest instead of
+// being sent one at a time.
+var digestEvents = map[string]bool{
+	lemon_api.WebhookEventFeedbackCreated: true,
+}
+
+// Digests names the notifiers that want each digest period, in a stable
+// order. Periods nobody wants are left out.
+func Digests(cfg *config.Webhooks) map[string][]string {
+	periods := map[string][]string{}
+	if cfg == nil {
+		return periods
+	}
+
+	for name, notifierCfg := range cfg.Notifiers {
+		if notifierCfg == nil {
+			continue
+		}
+		wanted := map[string]bool{}
+		for _, event := range notifierCfg.Events {
+			if period := digestPeriod(notifierCfg, event); period != lemon_api.DigestImmediate && !wanted[period] {
+				wanted[period] = true
+				periods[period] = append(periods[period], name)
+			}
+		}
+	}
+	for _, names := range periods {
+		sort.Strings(names)
+	}
+	return periods
+}
+
+// digestPeriod is how a notifier wants event delivered. Anything not
+// mentioned in its digests is sent immediately.
+func digestPeriod(cfg *config.NotifierConfig, event string) string {
+	if period := cfg.Digests[event]; period != "" {
+		return period
+	}
+	return lemon_api.DigestImmediate
+}
+
+func validateDigests(cfg *config.NotifierConfig) error {
+	for event, period := range cfg.Digests {
+		switch period {
+		case lemon_api.DigestImmediate, lemon_api.DigestHourly, lemon_api.DigestDaily:
+		default:
+			return errors.Wrapf(ErrInvalidNotifier, "unknown digest period %q", period)
+		}
+		if period == lemon_api.DigestImmediate {
+			continue
+		}
+		if !digestEvents[event] {
+			return errors.Wrapf(ErrInvalidNotifier, "event %q has no digest", event)
+		}
+		if !listed(cfg.Events, event) {
+			return errors.Wrapf(ErrInvalidNotifier, "digest for %q, which isn't in events", event)
+		}
+	}
+	return nil
+}
+
+func listed(events []string, event string) bool {
+	for _, e := range events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/config"
+)
+
+// discordContentLimit is the most characters Discord accepts in a message.
+const discordContentLimit = 2000
+
+// DiscordNotifier posts to a Discord channel webhook.
+type DiscordNotifier struct {
+	events
+	*renderer
+	url     string
+	name    string
+	iconURL string
+}
+
+func newDiscordNotifier(cfg *config.NotifierConfig, renderer *renderer) *DiscordNotifier {
+	return &DiscordNotifier{
+		events:   newEvents(cfg),
+		renderer: renderer,
+		url:      cfg.URL,
+		name:     cfg.Name,
+		iconURL:  cfg.IconURL,
+	}
+}
+
+func (d *DiscordNotifier) Send(ctx context.Context, delivery *lemon_api.WebhookDelivery) (int, error) {
+	message, err := d.Render(delivery)
+	if err != nil {
+		return 0, err
+	}
+
+	body := map[string]interface{}{
+		"content": truncate(discordContentLimit, message.Plain()),
+		// Player text must not be able to ping @everyone or roles.
+		"allowed_mentions": map[string][]string{"parse": {}},
+	}
+	if d.name != "" {
+		body["username"] = d.name
+	}
+	if d.iconURL != "" {
+		body["avatar_url"] = d.iconURL
+	}
+
+	return postJSON(ctx, d.url, nil, body, discordRetryAfter)
+}
+
+// discordRetryAfter reads how long Discord asked us to wait from the
+// retry_after field of a rate limit response, falling back to the
+// Retry-After header. Both are in seconds.
+func discordRetryAfter(header http.Header, body []byte) time.Duration {
+	var limited struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if err := json.Unmarshal(body, &limited); err == nil && limited.RetryAfter > 0 {
+		return time.Duration(limited.RetryAfter * float64(time.Second))
+	}
+	return retryAfterHeader(header, body)
+}
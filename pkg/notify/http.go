@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// SendTimeout is the longest a notifier waits for its destination before the
+// delivery fails.
+const SendTimeout = 10 * time.Second
+
+const maxResponseBody = 1024
+
+var httpClient = &http.Client{Timeout: SendTimeout}
+
+// postJSON sends body to url and turns any non 2xx answer into a
+// *StatusError. retryAfter, when set, reads how long a rate limited
+// destination asked us to wait.
+func postJSON(ctx context.Context, url string, headers map[string]string, body interface{}, retryAfter func(http.Header, []byte) time.Duration) (int, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+	return post(ctx, httpClient, url, headers, b, retryAfter)
+}
+
+// Post sends an already encoded JSON body with client, turning any non 2xx
+// answer into a *StatusError the way notifiers do.
+func Post(ctx context.Context, client *http.Client, url string, headers map[string]string, body []byte) (int, error) {
+	return post(ctx, client, url, headers, body, nil)
+}
+
+// post passes the trace in ctx on in W3C traceparent headers, so the
+// destination can continue it.
+func post(ctx context.Context, client *http.Client, url string, headers map[string]string, body []byte, retryAfter func(http.Header, []byte) time.Duration) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	statusErr := &StatusError{
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(respBody)),
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if retryAfter == nil {
+			retryAfter = retryAfterHeader
+		}
+		statusErr.RetryAfter = retryAfter(resp.Header, respBody)
+	}
+	return resp.StatusCode, statusErr
+}
+
+// retryAfterHeader reads a Retry-After header given in seconds.
+func retryAfterHeader(header http.Header, _ []byte) time.Duration {
+	if seconds, err := strconv.ParseFloat(header.Get("Retry-After"), 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return 0
+}
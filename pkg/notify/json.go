@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/config"
+)
+
+// JSONNotifier posts a generic JSON document to any URL. The document is a
+// Microsoft Teams message card, so it works with Teams connectors as is, and
+// it also carries the event name and raw data for services of our own.
+type JSONNotifier struct {
+	events
+	*renderer
+	url     string
+	headers map[string]string
+}
+
+type jsonAction struct {
+	Type    string          `json:"@type"`
+	Name    string          `json:"name"`
+	Targets []jsonActionURI `json:"targets"`
+}
+
+type jsonActionURI struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+type jsonMessage struct {
+	Type    string          `json:"@type"`
+	Context string          `json:"@context"`
+	Summary string          `json:"summary"`
+	Title   string          `json:"title"`
+	Text    string          `json:"text"`
+	Actions []jsonAction    `json:"potentialAction,omitempty"`
+	Event   string          `json:"event"`
+	URL     string          `json:"url,omitempty"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func newJSONNotifier(cfg *config.NotifierConfig, renderer *renderer) *JSONNotifier {
+	return &JSONNotifier{
+		events:   newEvents(cfg),
+		renderer: renderer,
+		url:      cfg.URL,
+		headers:  cfg.Headers,
+	}
+}
+
+func (j *JSONNotifier) Send(ctx context.Context, delivery *lemon_api.WebhookDelivery) (int, error) {
+	message, err := j.Render(delivery)
+	if err != nil {
+		return 0, err
+	}
+
+	body := jsonMessage{
+		Type:    "MessageCard",
+		Context: "https://schema.org/extensions",
+		Summary: message.Title,
+		Title:   message.Title,
+		// Teams reads text as markdown, which needs a blank line to break.
+		Text:  strings.Replace(message.Text, "\n", "\n\n", -1),
+		Event: delivery.Event,
+		URL:   message.URL,
+		Data:  delivery.Payload,
+	}
+	if message.URL != "" {
+		body.Actions = []jsonAction{{
+			Type:    "OpenUri",
+			Name:    "Open in Lemon",
+			Targets: []jsonActionURI{{OS: "default", URI: message.URL}},
+		}}
+	}
+
+	return postJSON(ctx, j.url, j.headers, body, nil)
+}
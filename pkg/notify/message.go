@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"strings"
+
+	lemon_api "lemon/lemon-api"
+)
+
+// Message is an event rendered for people to read. Each notifier lays it out
+// in whatever its destination expects.
+type Message struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	URL   string `json:"url"`
+}
+
+// Plain is the message as a single block of text, one part per line.
+func (m Message) Plain() string {
+	var parts []string
+	for _, part := range []string{m.Title, m.Text, m.URL} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// renderer turns deliveries into messages using one notifier's templates.
+type renderer struct {
+	site      string
+	templates map[string]*messageTemplate
+}
+
+func newRenderer(site string, templates map[string]*messageTemplate) *renderer {
+	return &renderer{
+		site:      site,
+		templates: templates,
+	}
+}
+
+// Render builds the message a delivery would be sent as.
+func (r *renderer) Render(delivery *lemon_api.WebhookDelivery) (Message, error) {
+	tmpl, ok := r.templates[delivery.Event]
+	if !ok {
+		return Message{}, errUnknownEvent
+	}
+
+	data, err := newTemplateData(delivery, r.site)
+	if err != nil {
+		return Message{}, err
+	}
+	return tmpl.execute(data)
+}
@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/config"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	TypeDiscord = "discord"
+	TypeSlack   = "slack"
+	TypeJSON    = "json"
+	TypeSMTP    = "smtp"
+)
+
+const defaultSiteURL = "https://lemon.indiedev.io"
+
+var (
+	ErrInvalidNotifier = errors.New("invalid notifier")
+	ErrUnknownType     = errors.New("unknown notifier type")
+
+	errUnknownEvent = errors.New("event not handled by notifier")
+)
+
+// Notifier sends events to one destination, such as a Discord channel or a
+// mailing list.
+type Notifier interface {
+	// Handles reports whether the notifier wants an event, so it is only
+	// queued for notifiers that will deliver it.
+	Handles(event string) bool
+	// Render builds the message an event would be sent as.
+	Render(delivery *lemon_api.WebhookDelivery) (Message, error)
+	// Send delivers an event and returns the status the destination answered
+	// with. Failed deliveries return a *StatusError when it answered at all.
+	// HTTP notifiers pass the trace in ctx on in traceparent headers.
+	Send(ctx context.Context, delivery *lemon_api.WebhookDelivery) (int, error)
+}
+
+// StatusError is a delivery the destination rejected. RetryAfter is set when
+// the destination asked us to slow down.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("notifier returned %d: %s", e.StatusCode, e.Body)
+}
+
+// New builds the notifiers named in the config. The older discord-feedback
+// and discord-new-user URLs still work and become Discord notifiers of the
+// same names, unless a notifier already uses that name.
+func New(cfg *config.Webhooks) (map[string]Notifier, error) {
+	notifiers := map[string]Notifier{}
+	if cfg == nil {
+		return notifiers, nil
+	}
+
+	site := siteURL(cfg.SiteURL)
+
+	templates, err := compileTemplates(cfg.Templates)
+	if err != nil {
+		return nil, errors.Wrap(err, "templates")
+	}
+
+	for name, notifierCfg := range legacyNotifiers(cfg) {
+		if _, taken := cfg.Notifiers[name]; taken {
+			continue
+		}
+		notifiers[name] = newDiscordNotifier(notifierCfg, newRenderer(site, templates))
+	}
+
+	for name, notifierCfg := range cfg.Notifiers {
+		notifier, err := newNotifier(notifierCfg, site, cfg.Templates)
+		if err != nil {
+			return nil, errors.Wrapf(err, "notifier %q", name)
+		}
+		notifiers[name] = notifier
+	}
+
+	return notifiers, nil
+}
+
+// For names the notifiers that handle an event, in a stable order.
+func For(notifiers map[string]Notifier, event string) []string {
+	var names []string
+	for name, notifier := range notifiers {
+		if notifier.Handles(event) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newNotifier(cfg *config.NotifierConfig, site string, defaults map[string]*config.MessageTemplate) (Notifier, error) {
+	if cfg == nil {
+		return nil, ErrInvalidNotifier
+	}
+	if len(cfg.Events) == 0 {
+		return nil, errors.Wrap(ErrInvalidNotifier, "no events")
+	}
+	for _, event := range cfg.Events {
+		if !lemon_api.IsWebhookEvent(event) {
+			return nil, errors.Wrapf(ErrInvalidNotifier, "unknown event %q", event)
+		}
+		if event == lemon_api.WebhookEventFeedbackDigest {
+			return nil, errors.Wrap(ErrInvalidNotifier, "ask for digests with the digests setting")
+		}
+	}
+	if err := validateDigests(cfg); err != nil {
+		return nil, err
+	}
+
+	switch cfg.Type {
+	case TypeDiscord, TypeSlack, TypeJSON:
+		if !strings.HasPrefix(cfg.URL, "https://") && !strings.HasPrefix(cfg.URL, "http://") {
+			return nil, errors.Wrap(ErrInvalidNotifier, "url must be http or https")
+		}
+	}
+
+	switch cfg.Type {
+	case TypeDiscord, TypeSlack, TypeJSON, TypeSMTP:
+	default:
+		return nil, errors.Wrap(ErrUnknownType, cfg.Type)
+	}
+
+	templates, err := compileTemplates(defaults, cfg.Templates)
+	if err != nil {
+		return nil, err
+	}
+	renderer := newRenderer(site, templates)
+
+	switch cfg.Type {
+	case TypeDiscord:
+		return newDiscordNotifier(cfg, renderer), nil
+	case TypeSlack:
+		return newSlackNotifier(cfg, renderer), nil
+	case TypeJSON:
+		return newJSONNotifier(cfg, renderer), nil
+	}
+	return newSMTPNotifier(cfg, renderer)
+}
+
+// siteURL is the base of the links notifications point at.
+func siteURL(site string) string {
+	if site == "" {
+		site = defaultSiteURL
+	}
+	return strings.TrimRight(site, "/")
+}
+
+func legacyNotifiers(cfg *config.Webhooks) map[string]*config.NotifierConfig {
+	legacy := map[string]*config.NotifierConfig{}
+	if cfg.FeedbackURL != "" {
+		legacy["discord-feedback"] = &config.NotifierConfig{
+			Type:    TypeDiscord,
+			Events:  []string{lemon_api.WebhookEventFeedbackCreated},
+			URL:     cfg.FeedbackURL,
+			Name:    "Feedback Piggy",
+			IconURL: "https://www.discordavatars.com/wp-content/uploads/2020/07/disney-character-avatar-074.jpg",
+		}
+	}
+	if cfg.NewUserURL != "" {
+		legacy["discord-new-user"] = &config.NotifierConfig{
+			Type:    TypeDiscord,
+			Events:  []string{lemon_api.WebhookEventUserRegistered},
+			URL:     cfg.NewUserURL,
+			Name:    "Big Brother",
+			IconURL: "https://www.discordavatars.com/wp-content/uploads/2020/10/cctv-camera-avatar-150x150.jpg",
+		}
+	}
+	return legacy
+}
+
+// events is the set of events a notifier was configured for. Events it takes
+// as a digest are swapped for the digest event.
+type events map[string]bool
+
+func newEvents(cfg *config.NotifierConfig) events {
+	set := events{}
+	for _, name := range cfg.Events {
+		if digestPeriod(cfg, name) != lemon_api.DigestImmediate {
+			set[lemon_api.WebhookEventFeedbackDigest] = true
+			continue
+		}
+		set[name] = true
+	}
+	return set
+}
+
+func (e events) Handles(event string) bool {
+	return e[event]
+}
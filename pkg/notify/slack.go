@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"context"
+	"strings"
+
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/config"
+)
+
+// SlackNotifier posts to a Slack incoming webhook.
+type SlackNotifier struct {
+	events
+	*renderer
+	url     string
+	name    string
+	iconURL string
+}
+
+func newSlackNotifier(cfg *config.NotifierConfig, renderer *renderer) *SlackNotifier {
+	return &SlackNotifier{
+		events:   newEvents(cfg),
+		renderer: renderer,
+		url:      cfg.URL,
+		name:     cfg.Name,
+		iconURL:  cfg.IconURL,
+	}
+}
+
+func (s *SlackNotifier) Send(ctx context.Context, delivery *lemon_api.WebhookDelivery) (int, error) {
+	message, err := s.Render(delivery)
+	if err != nil {
+		return 0, err
+	}
+
+	text := "*" + slackEscape(message.Title) + "*"
+	if message.Text != "" {
+		text += "\n" + slackEscape(message.Text)
+	}
+	if message.URL != "" {
+		text += "\n<" + message.URL + ">"
+	}
+
+	body := map[string]string{
+		"text": text,
+	}
+	if s.name != "" {
+		body["username"] = s.name
+	}
+	if s.iconURL != "" {
+		body["icon_url"] = s.iconURL
+	}
+
+	return postJSON(ctx, s.url, nil, body, nil)
+}
+
+var slackReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackEscape escapes the characters Slack treats as markup, so player text
+// can't ping channels or forge links.
+func slackEscape(text string) string {
+	return slackReplacer.Replace(text)
+}
@@ -0,0 +1,174 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/config"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultSMTPPort = 587
+	// smtpsPort speaks TLS from the start rather than upgrading with STARTTLS.
+	smtpsPort = 465
+)
+
+// SMTPNotifier emails events to a fixed list of addresses.
+type SMTPNotifier struct {
+	events
+	*renderer
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func newSMTPNotifier(cfg *config.NotifierConfig, renderer *renderer) (*SMTPNotifier, error) {
+	if cfg.Host == "" {
+		return nil, errors.Wrap(ErrInvalidNotifier, "no host")
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, errors.Wrap(ErrInvalidNotifier, "bad from address")
+	}
+	if len(cfg.To) == 0 {
+		return nil, errors.Wrap(ErrInvalidNotifier, "no recipients")
+	}
+	for _, to := range cfg.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return nil, errors.Wrapf(ErrInvalidNotifier, "bad recipient %q", to)
+		}
+	}
+
+	port := cfg.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+
+	return &SMTPNotifier{
+		events:   newEvents(cfg),
+		renderer: renderer,
+		host:     cfg.Host,
+		port:     port,
+		username: cfg.Username,
+		password: cfg.Password,
+		from:     cfg.From,
+		to:       cfg.To,
+	}, nil
+}
+
+// Send mails the event. When the server refuses it, the SMTP reply code is
+// returned as the status.
+func (m *SMTPNotifier) Send(ctx context.Context, delivery *lemon_api.WebhookDelivery) (int, error) {
+	message, err := m.Render(delivery)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := m.send(m.email(message)); err != nil {
+		if reply, ok := err.(*textproto.Error); ok {
+			return reply.Code, &StatusError{StatusCode: reply.Code, Body: reply.Msg}
+		}
+		return 0, err
+	}
+	return 250, nil
+}
+
+func (m *SMTPNotifier) email(message Message) []byte {
+	// Headers can't contain line breaks, whatever the title says.
+	subject := strings.Join(strings.Fields(message.Title), " ")
+
+	body := message.Text
+	if message.URL != "" {
+		body += "\n\n" + message.URL
+	}
+
+	var b bytes.Buffer
+	b.WriteString("From: " + m.from + "\r\n")
+	b.WriteString("To: " + strings.Join(m.to, ", ") + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().UTC().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// send is smtp.SendMail with a deadline, so a stuck mail server can't hold up
+// the dispatcher, and with support for implicit TLS on port 465.
+func (m *SMTPNotifier) send(email []byte) error {
+	addr := net.JoinHostPort(m.host, strconv.Itoa(m.port))
+	tlsConfig := &tls.Config{ServerName: m.host}
+
+	dialer := &net.Dialer{Timeout: SendTimeout}
+	var conn net.Conn
+	var err error
+	if m.port == smtpsPort {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(SendTimeout))
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if m.port != smtpsPort {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+
+	from, _ := mail.ParseAddress(m.from)
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range m.to {
+		address, _ := mail.ParseAddress(to)
+		if err := client.Rcpt(address.Address); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(email); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,423 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/config"
+
+	"github.com/pkg/errors"
+)
+
+// maxMessageSize caps what one template part can render to.
+const maxMessageSize = 16 * 1024
+
+var (
+	ErrInvalidTemplate = errors.New("invalid template")
+
+	errMessageTooLong = errors.New("message too long")
+)
+
+// defaultTemplates are used for any part of a message nothing overrides.
+var defaultTemplates = map[string]*config.MessageTemplate{
+	lemon_api.WebhookEventFeedbackCreated: {
+		Title: "New feedback given!",
+		Text:  "Rating: {{.Feedback.Rating}}\nType: {{.Feedback.Type}}{{range summary .Feedback}}\n{{.}}{{end}}",
+		URL:   "{{.SiteURL}}/feedback/{{.Feedback.ID}}",
+	},
+	lemon_api.WebhookEventFeedbackStatusChanged: {
+		Title: "Feedback #{{.StatusChange.FeedbackID}} is now {{.StatusChange.ToStatus}}",
+		Text:  "Moved from {{.StatusChange.FromStatus}} to {{.StatusChange.ToStatus}}{{with .StatusChange.DuplicateOf}}, duplicate of #{{.}}{{end}}.",
+		URL:   "{{.SiteURL}}/feedback/{{.StatusChange.FeedbackID}}",
+	},
+	lemon_api.WebhookEventUserRegistered: {
+		Title: "New player",
+		Text:  "{{.User.Username}} has joined the party!",
+	},
+	lemon_api.WebhookEventSaveUpdated: {
+		Title: "Save updated",
+		Text:  "Player {{.Save.AccountID}} saved slot {{.Save.Slot}}{{with .Save.SaveVersion}} at version {{.}}{{end}}.",
+	},
+	lemon_api.WebhookEventFeedbackDigest: {
+		Title: "{{if eq .Digest.Period \"daily\"}}Daily{{else}}Hourly{{end}} feedback digest for {{.Game.Name}}",
+		Text: "{{.Digest.Count}} new feedback, average rating {{printf \"%.1f\" .Digest.AverageRating}}" +
+			"{{with .Digest.Types}}\nTop types: {{range $i, $t := .}}{{if $i}}, {{end}}{{or $t.Type \"none\"}} ({{$t.Count}}){{end}}{{end}}" +
+			"{{with .Digest.Lowest}}\nLowest rated:{{range .}}\n#{{.ID}} ({{.Rating}}) {{truncate 100 .Description}}{{end}}{{end}}",
+		URL: "{{.SiteURL}}/feedback",
+	},
+}
+
+// TemplateData is what message templates are executed against. One of
+// Feedback, StatusChange, User, Save and Digest is set, depending on the
+// event; Payload is the raw event for anything else.
+type TemplateData struct {
+	Event        string
+	SiteURL      string
+	Game         lemon_api.Game
+	Feedback     *lemon_api.Feedback
+	StatusChange *lemon_api.FeedbackStatusChangedEvent
+	User         *lemon_api.UserRegisteredEvent
+	Save         *lemon_api.SaveUpdatedEvent
+	Digest       *lemon_api.FeedbackDigest
+	Payload      map[string]interface{}
+}
+
+var templateFuncs = template.FuncMap{
+	"summary":  feedbackSummary,
+	"truncate": truncate,
+	"join":     strings.Join,
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"trim":     strings.TrimSpace,
+}
+
+func newTemplateData(delivery *lemon_api.WebhookDelivery, site string) (*TemplateData, error) {
+	data := &TemplateData{
+		Event:   delivery.Event,
+		SiteURL: site,
+		Game: lemon_api.Game{
+			ID:   delivery.GameID,
+			Name: delivery.GameName,
+			Slug: delivery.GameSlug,
+		},
+	}
+
+	if err := json.Unmarshal(delivery.Payload, &data.Payload); err != nil {
+		return nil, err
+	}
+
+	var event interface{}
+	switch delivery.Event {
+	case lemon_api.WebhookEventFeedbackCreated:
+		data.Feedback = &lemon_api.Feedback{}
+		event = data.Feedback
+	case lemon_api.WebhookEventFeedbackStatusChanged:
+		data.StatusChange = &lemon_api.FeedbackStatusChangedEvent{}
+		event = data.StatusChange
+	case lemon_api.WebhookEventUserRegistered:
+		data.User = &lemon_api.UserRegisteredEvent{}
+		event = data.User
+	case lemon_api.WebhookEventSaveUpdated:
+		data.Save = &lemon_api.SaveUpdatedEvent{}
+		event = data.Save
+	case lemon_api.WebhookEventFeedbackDigest:
+		data.Digest = &lemon_api.FeedbackDigest{}
+		event = data.Digest
+	default:
+		return data, nil
+	}
+	if err := json.Unmarshal(delivery.Payload, event); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// messageTemplate is a compiled MessageTemplate. Parts left empty render as
+// nothing.
+type messageTemplate struct {
+	title *template.Template
+	text  *template.Template
+	url   *template.Template
+}
+
+func (t *messageTemplate) execute(data *TemplateData) (Message, error) {
+	var message Message
+	var err error
+	if message.Title, err = executePart(t.title, data); err != nil {
+		return Message{}, err
+	}
+	if message.Text, err = executePart(t.text, data); err != nil {
+		return Message{}, err
+	}
+	if message.URL, err = executePart(t.url, data); err != nil {
+		return Message{}, err
+	}
+	return message, nil
+}
+
+func executePart(tmpl *template.Template, data *TemplateData) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&limitedWriter{buf: &b, left: maxMessageSize}, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// limitedWriter stops a template once it has written too much, so a runaway
+// range can't eat the server's memory.
+type limitedWriter struct {
+	buf  *bytes.Buffer
+	left int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > w.left {
+		return 0, errMessageTooLong
+	}
+	w.left -= len(p)
+	return w.buf.Write(p)
+}
+
+// compileTemplates builds the templates for every event. Later layers
+// override earlier ones part by part, on top of the defaults, and each
+// result is tried against sample data so mistakes show up at startup rather
+// than when something happens.
+func compileTemplates(layers ...map[string]*config.MessageTemplate) (map[string]*messageTemplate, error) {
+	for _, layer := range layers {
+		for event := range layer {
+			if !lemon_api.IsWebhookEvent(event) {
+				return nil, errors.Wrapf(ErrInvalidTemplate, "unknown event %q", event)
+			}
+		}
+	}
+
+	templates := map[string]*messageTemplate{}
+	for _, event := range lemon_api.WebhookEvents {
+		var title, text, url string
+		for _, layer := range append([]map[string]*config.MessageTemplate{defaultTemplates}, layers...) {
+			source := layer[event]
+			if source == nil {
+				continue
+			}
+
+			var err error
+			if title, err = templatePart(source.Title, source.TitleFile, title); err != nil {
+				return nil, err
+			}
+			if text, err = templatePart(source.Text, source.TextFile, text); err != nil {
+				return nil, err
+			}
+			if source.URL != "" {
+				url = source.URL
+			}
+		}
+
+		tmpl, err := parseTemplate(event, title, text, url)
+		if err != nil {
+			return nil, err
+		}
+		templates[event] = tmpl
+	}
+	return templates, nil
+}
+
+// templatePart picks the inline template, then the file, then what an
+// earlier layer set.
+func templatePart(inline string, file string, fallback string) (string, error) {
+	if inline != "" {
+		return inline, nil
+	}
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", errors.Wrapf(ErrInvalidTemplate, "reading %s: %v", file, err)
+		}
+		return string(b), nil
+	}
+	return fallback, nil
+}
+
+// parseTemplate compiles the parts of a message for event and checks they
+// execute against that event's sample data.
+func parseTemplate(event string, title string, text string, url string) (*messageTemplate, error) {
+	tmpl := &messageTemplate{}
+	parts := []struct {
+		name   string
+		source string
+		into   **template.Template
+	}{
+		{"title", title, &tmpl.title},
+		{"text", text, &tmpl.text},
+		{"url", url, &tmpl.url},
+	}
+	for _, part := range parts {
+		if part.source == "" {
+			continue
+		}
+		parsed, err := template.New(event + " " + part.name).
+			Funcs(templateFuncs).
+			Option("missingkey=error").
+			Parse(part.source)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidTemplate, err.Error())
+		}
+		*part.into = parsed
+	}
+
+	sample, err := Sample(event, sampleGame)
+	if err != nil {
+		return nil, err
+	}
+	data, err := newTemplateData(sample, defaultSiteURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmpl.execute(data); err != nil {
+		return nil, errors.Wrap(ErrInvalidTemplate, err.Error())
+	}
+	return tmpl, nil
+}
+
+// RenderTemplate renders a template that isn't configured anywhere, such as
+// one a developer is trying out. Parts it leaves empty fall back to the
+// configured and built in templates. Only inline templates are used.
+func RenderTemplate(cfg *config.Webhooks, tmpl config.MessageTemplate, delivery *lemon_api.WebhookDelivery) (Message, error) {
+	if !lemon_api.IsWebhookEvent(delivery.Event) {
+		return Message{}, errors.Wrapf(ErrInvalidTemplate, "unknown event %q", delivery.Event)
+	}
+	tmpl.TitleFile = ""
+	tmpl.TextFile = ""
+
+	var site string
+	var configured map[string]*config.MessageTemplate
+	if cfg != nil {
+		site = cfg.SiteURL
+		configured = cfg.Templates
+	}
+	templates, err := compileTemplates(configured, map[string]*config.MessageTemplate{delivery.Event: &tmpl})
+	if err != nil {
+		return Message{}, err
+	}
+	return newRenderer(siteURL(site), templates).Render(delivery)
+}
+
+var sampleGame = lemon_api.Game{
+	ID:   "00000000-0000-0000-0000-000000000000",
+	Slug: "sample-game",
+	Name: "Sample Game",
+}
+
+// Sample is a made up delivery of event in game, for trying templates out.
+func Sample(event string, game lemon_api.Game) (*lemon_api.WebhookDelivery, error) {
+	var payload interface{}
+	switch event {
+	case lemon_api.WebhookEventFeedbackCreated:
+		submitted := time.Now().UTC()
+		payload = lemon_api.Feedback{
+			ID:          42,
+			GameID:      game.ID,
+			Rating:      4,
+			Description: "The second boss is too hard and the music cuts out when you pause.",
+			Type:        "bug",
+			Build:       "1.4.2",
+			Metadata: lemon_api.FeedbackMetadata{
+				Platform:  "windows",
+				Locale:    "en-GB",
+				Scene:     "boss-2",
+				SessionID: "5f2b8c1e",
+				Context:   map[string]interface{}{"difficulty": "hard"},
+			},
+			Submitted: &submitted,
+			Status:    lemon_api.FeedbackStatusNew,
+		}
+	case lemon_api.WebhookEventFeedbackStatusChanged:
+		changed := time.Now().UTC()
+		payload = lemon_api.FeedbackStatusChangedEvent{
+			FeedbackID: 42,
+			FromStatus: lemon_api.FeedbackStatusNew,
+			ToStatus:   lemon_api.FeedbackStatusTriaged,
+			ChangedBy:  "22222222-2222-2222-2222-222222222222",
+			Changed:    &changed,
+		}
+	case lemon_api.WebhookEventUserRegistered:
+		payload = lemon_api.UserRegisteredEvent{
+			ID:       "11111111-1111-1111-1111-111111111111",
+			Username: "sample_player",
+		}
+	case lemon_api.WebhookEventSaveUpdated:
+		updated := time.Now().UTC()
+		payload = lemon_api.SaveUpdatedEvent{
+			AccountID:   "11111111-1111-1111-1111-111111111111",
+			Slot:        lemon_api.DefaultSaveSlot,
+			SaveVersion: "1.4.2",
+			Updated:     &updated,
+		}
+	case lemon_api.WebhookEventFeedbackDigest:
+		to := time.Now().UTC().Truncate(24 * time.Hour)
+		from := to.Add(-24 * time.Hour)
+		payload = lemon_api.FeedbackDigest{
+			Period:        lemon_api.DigestDaily,
+			From:          &from,
+			To:            &to,
+			Count:         12,
+			AverageRating: 3.6,
+			Types: []*lemon_api.FeedbackTypeStat{
+				{Type: "bug", Count: 7, Unread: 5},
+				{Type: "suggestion", Count: 4, Unread: 4},
+				{Type: "", Count: 1, Unread: 1},
+			},
+			Lowest: []*lemon_api.Feedback{
+				{ID: 40, GameID: game.ID, Rating: 1, Description: "Crashes every time I open the map.", Type: "bug", Submitted: &from, Status: lemon_api.FeedbackStatusNew},
+				{ID: 45, GameID: game.ID, Rating: 2, Description: "The second boss is too hard.", Type: "suggestion", Submitted: &from, Status: lemon_api.FeedbackStatusNew},
+			},
+		}
+	default:
+		return nil, errors.Wrapf(ErrInvalidTemplate, "unknown event %q", event)
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &lemon_api.WebhookDelivery{
+		GameID:   game.ID,
+		GameName: game.Name,
+		GameSlug: game.Slug,
+		Event:    event,
+		Payload:  b,
+	}, nil
+}
+
+// feedbackSummary lists the build and metadata a notification should mention
+// as "Name: value" lines, skipping anything the game didn't send.
+func feedbackSummary(feedback *lemon_api.Feedback) []string {
+	var lines []string
+	if feedback == nil {
+		return lines
+	}
+	add := func(name string, value string) {
+		if value != "" {
+			lines = append(lines, name+": "+value)
+		}
+	}
+	add("Build", feedback.Build)
+	add("Platform", feedback.Metadata.Platform)
+	add("Locale", feedback.Metadata.Locale)
+	add("Scene", feedback.Metadata.Scene)
+	add("Session", feedback.Metadata.SessionID)
+
+	if len(feedback.Metadata.Context) > 0 {
+		keys := make([]string, 0, len(feedback.Metadata.Context))
+		for key := range feedback.Metadata.Context {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			add(key, fmt.Sprint(feedback.Metadata.Context[key]))
+		}
+	}
+	return lines
+}
+
+// truncate shortens s to at most n characters, ending with an ellipsis when
+// anything was cut.
+func truncate(n int, s string) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	if n < 1 {
+		return ""
+	}
+	return string(runes[:n-1]) + "…"
+}
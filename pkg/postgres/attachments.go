@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	lemon_api "lemon/lemon-api"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func (srv *Service) prepareAttachmentStatements() error {
+	var err error
+
+	srv.stmtInsertFeedbackAttachment, err = srv.prepareNamed("stmtInsertFeedbackAttachment", `
+	INSERT INTO feedback_attachments (
+		feedback_id,
+	    filename,
+	    content_type,
+	    size,
+	    storage_key,
+	    created
+	    ) VALUES (
+	    :feedback_id,
+	    :filename,
+	    :content_type,
+	    :size,
+	    :storage_key,
+	    :created
+	)
+	RETURNING id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtInsertFeedbackAttachment")
+		return err
+	}
+
+	srv.stmtGetFeedbackAttachments, err = srv.prepareNamed("stmtGetFeedbackAttachments", `
+	SELECT
+		a.id,
+	    a.feedback_id,
+	    a.filename,
+	    a.content_type,
+	    a.size,
+	    a.storage_key,
+	    a.created
+	FROM
+		feedback_attachments a
+	JOIN
+		feedback f ON f.id = a.feedback_id
+	WHERE
+		a.feedback_id = :feedback_id AND f.game_id = :game_id
+	ORDER BY
+		a.id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetFeedbackAttachments")
+		return err
+	}
+
+	srv.stmtGetFeedbackAttachment, err = srv.prepareNamed("stmtGetFeedbackAttachment", `
+	SELECT
+		a.id,
+	    a.feedback_id,
+	    a.filename,
+	    a.content_type,
+	    a.size,
+	    a.storage_key,
+	    a.created
+	FROM
+		feedback_attachments a
+	JOIN
+		feedback f ON f.id = a.feedback_id
+	WHERE
+		a.id = :id AND a.feedback_id = :feedback_id AND f.game_id = :game_id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetFeedbackAttachment")
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) GetFeedbackAttachments(gameID string, feedbackID int64) ([]*lemon_api.FeedbackAttachment, error) {
+	var attachments []*lemon_api.FeedbackAttachment
+	query := struct {
+		GameID     string `db:"game_id"`
+		FeedbackID int64  `db:"feedback_id"`
+	}{
+		GameID:     gameID,
+		FeedbackID: feedbackID,
+	}
+	err := s.stmtGetFeedbackAttachments.SelectContext(s.ctx, &attachments, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetFeedbackAttachments")
+		return nil, err
+	}
+	return attachments, err
+}
+
+func (s *Service) GetFeedbackAttachment(gameID string, feedbackID int64, ID int64) (*lemon_api.FeedbackAttachment, error) {
+	var attachment lemon_api.FeedbackAttachment
+	query := struct {
+		GameID     string `db:"game_id"`
+		FeedbackID int64  `db:"feedback_id"`
+		ID         int64  `db:"id"`
+	}{
+		GameID:     gameID,
+		FeedbackID: feedbackID,
+		ID:         ID,
+	}
+	err := s.stmtGetFeedbackAttachment.GetContext(s.ctx, &attachment, query)
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
@@ -1,10 +1,12 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	lemon_api "lemon/lemon-api"
 	"lemon/lemon-api/pkg/config"
+	"lemon/lemon-api/pkg/metrics"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -12,17 +14,74 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// connectTimeout is how many seconds one attempt at connecting may take.
+const connectTimeout = 10
+
 type Service struct {
 	config *config.Config
 
-	conn *sqlx.DB
+	conn  *sqlx.DB
+	stmts []*sqlx.NamedStmt
+	// ctx is what queries run under; see WithContext.
+	ctx context.Context
 
 	encryptionKey string
 
-	stmtInsertFeedback   *sqlx.NamedStmt
-	stmtGetFeedback      *sqlx.NamedStmt
-	stmtGetFeedbackByID  *sqlx.NamedStmt
-	stmtMarkReadFeedback *sqlx.NamedStmt
+	stmtInsertFeedback    *sqlx.NamedStmt
+	stmtGetFeedbackByID   *sqlx.NamedStmt
+	stmtMarkReadFeedback  *sqlx.NamedStmt
+	stmtGetRecentFeedback *sqlx.NamedStmt
+
+	stmtUpdateFeedbackStatus       *sqlx.NamedStmt
+	stmtInsertFeedbackStatusChange *sqlx.NamedStmt
+	stmtGetFeedbackHistory         *sqlx.NamedStmt
+	stmtAssignFeedback             *sqlx.NamedStmt
+	stmtInsertFeedbackNote         *sqlx.NamedStmt
+	stmtGetFeedbackNotes           *sqlx.NamedStmt
+
+	stmtInsertFeedbackAttachment *sqlx.NamedStmt
+	stmtGetFeedbackAttachments   *sqlx.NamedStmt
+	stmtGetFeedbackAttachment    *sqlx.NamedStmt
+
+	stmtInsertFeedbackReply     *sqlx.NamedStmt
+	stmtGetFeedbackReplies      *sqlx.NamedStmt
+	stmtMarkFeedbackRepliesRead *sqlx.NamedStmt
+	stmtGetAccountFeedback      *sqlx.NamedStmt
+
+	stmtInsertSurvey          *sqlx.NamedStmt
+	stmtUpdateSurvey          *sqlx.NamedStmt
+	stmtUpdateSurveyStatus    *sqlx.NamedStmt
+	stmtGetSurvey             *sqlx.NamedStmt
+	stmtGetSurveys            *sqlx.NamedStmt
+	stmtGetPublishedSurveys   *sqlx.NamedStmt
+	stmtInsertSurveyResponse  *sqlx.NamedStmt
+	stmtCountSurveyResponses  *sqlx.NamedStmt
+	stmtGetSurveyAnswered     *sqlx.NamedStmt
+	stmtGetSurveyAnswerCounts *sqlx.NamedStmt
+
+	stmtInsertWebhook        *sqlx.NamedStmt
+	stmtClaimWebhooks        *sqlx.NamedStmt
+	stmtCompleteWebhook      *sqlx.NamedStmt
+	stmtFailWebhook          *sqlx.NamedStmt
+	stmtGetWebhookDeliveries *sqlx.NamedStmt
+	stmtReplayWebhook        *sqlx.NamedStmt
+	stmtGetWebhookAttempts   *sqlx.NamedStmt
+	stmtGetWebhookBacklog    *sqlx.NamedStmt
+
+	stmtInsertSubscription        *sqlx.NamedStmt
+	stmtUpdateSubscription        *sqlx.NamedStmt
+	stmtDeleteSubscription        *sqlx.NamedStmt
+	stmtGetSubscription           *sqlx.NamedStmt
+	stmtGetSubscriptions          *sqlx.NamedStmt
+	stmtGetDeliverySubscription   *sqlx.NamedStmt
+	stmtRotateSubscriptionSecret  *sqlx.NamedStmt
+	stmtEnqueueSubscriptionEvents *sqlx.NamedStmt
+
+	stmtClaimDigest     *sqlx.NamedStmt
+	stmtGetDigestGames  *sqlx.NamedStmt
+	stmtGetDigestTotals *sqlx.NamedStmt
+	stmtGetDigestTypes  *sqlx.NamedStmt
+	stmtGetDigestLowest *sqlx.NamedStmt
 
 	stmtNewUser           *sqlx.NamedStmt
 	stmtGetUserByID       *sqlx.NamedStmt
@@ -30,6 +89,38 @@ type Service struct {
 	stmtUpdateUser        *sqlx.NamedStmt
 	stmtElevateUser       *sqlx.NamedStmt
 	stmtDeleteUser        *sqlx.NamedStmt
+
+	stmtInsertSaveFailure    *sqlx.NamedStmt
+	stmtGetSaveFailureReport *sqlx.NamedStmt
+
+	stmtUpsertSaveSchema    *sqlx.NamedStmt
+	stmtGetSaveSchemas      *sqlx.NamedStmt
+	stmtGetSaveSchema       *sqlx.NamedStmt
+	stmtUpsertSaveMigration *sqlx.NamedStmt
+	stmtGetSaveMigrations   *sqlx.NamedStmt
+
+	stmtGetSave         *sqlx.NamedStmt
+	stmtGetSaves        *sqlx.NamedStmt
+	stmtUpsertSave      *sqlx.NamedStmt
+	stmtInsertSaveShare *sqlx.NamedStmt
+	stmtGetSaveShare    *sqlx.NamedStmt
+	stmtRedeemSaveShare *sqlx.NamedStmt
+
+	stmtInsertGame          *sqlx.NamedStmt
+	stmtGetGameBySlug       *sqlx.NamedStmt
+	stmtGetGameByAPIKey     *sqlx.NamedStmt
+	stmtGetDeveloperGames   *sqlx.NamedStmt
+	stmtUpdateGameSharing   *sqlx.NamedStmt
+	stmtAddGameDeveloper    *sqlx.NamedStmt
+	stmtRemoveGameDeveloper *sqlx.NamedStmt
+	stmtIsGameDeveloper     *sqlx.NamedStmt
+
+	stmtInsertDeviceCode         *sqlx.NamedStmt
+	stmtGetDeviceCode            *sqlx.NamedStmt
+	stmtPollDeviceCode           *sqlx.NamedStmt
+	stmtResolveDeviceCode        *sqlx.NamedStmt
+	stmtConsumeDeviceCode        *sqlx.NamedStmt
+	stmtDeleteExpiredDeviceCodes *sqlx.NamedStmt
 }
 
 func NewService(cfg *config.Config) (*Service, error) {
@@ -42,31 +133,55 @@ func NewService(cfg *config.Config) (*Service, error) {
 
 	srv := &Service{
 		config:        cfg,
+		ctx:           context.Background(),
 		encryptionKey: cfg.Databases.Gamejam.EncryptionKey,
 	}
 
-	conn, err := sqlx.Connect("postgres", fmt.Sprintf("postgres://%v:%v@%v:%d/%v",
+	conn, err := sqlx.Connect(instrumentedDriverName, fmt.Sprintf("postgres://%v:%v@%v:%d/%v?connect_timeout=%d",
 		cfg.Databases.Gamejam.Username,
 		cfg.Databases.Gamejam.Password,
 		cfg.Databases.Gamejam.Hostname,
 		cfg.Databases.Gamejam.Port,
-		cfg.Databases.Gamejam.Database))
+		cfg.Databases.Gamejam.Database,
+		connectTimeout))
 	if err != nil {
 		return nil, err
 	}
 
 	srv.conn = conn
-
-	srv.stmtInsertFeedback, err = srv.conn.PrepareNamed(`
+	prepared := false
+	defer func() {
+		// Callers retry a service that failed to start, so don't leave its
+		// connections open.
+		if !prepared {
+			srv.Close()
+		}
+	}()
+
+	srv.stmtInsertFeedback, err = srv.prepareNamed("stmtInsertFeedback", `
 	INSERT INTO feedback (
+		game_id,
 		rating,
 	    description,
 	    type,
+	    account_id,
+	    build,
+	    metadata,
+	    status,
+	    quarantine_reason,
+	    duplicate_of,
 	    submitted
 	    ) VALUES (
+	    :game_id,
 	    :rating,
 		:description,
 	    :type,
+	    :account_id,
+	    NULLIF(:build, ''),
+	    :metadata,
+	    COALESCE(NULLIF(:status, ''), 'new'),
+	    :quarantine_reason,
+	    :duplicate_of,
 	    :submitted
 	)
 	RETURNING id;
@@ -76,115 +191,181 @@ func NewService(cfg *config.Config) (*Service, error) {
 		return nil, err
 	}
 
-	srv.stmtGetFeedback, err = srv.conn.PrepareNamed(`
+	srv.stmtGetFeedbackByID, err = srv.prepareNamed("stmtGetFeedbackByID", `
 	SELECT 
+		id,
 		rating,
 	    description,
 	    type,
+	    account_id,
+	    COALESCE(build, '') AS build,
+	    metadata,
 	    submitted,
-	    read
+	    read,
+	    status,
+	    assignee_id,
+	    duplicate_of,
+	    quarantine_reason
 	FROM
 		feedback
+	WHERE
+		id = :id AND game_id = :game_id;
 `)
 	if err != nil {
-		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetFeedback")
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetFeedbackByID")
 		return nil, err
 	}
 
-	srv.stmtGetFeedbackByID, err = srv.conn.PrepareNamed(`
-	SELECT 
-		rating,
+	srv.stmtGetRecentFeedback, err = srv.prepareNamed("stmtGetRecentFeedback", `
+	SELECT
+		id,
 	    description,
-	    type,
-	    submitted,
-	    read
+	    duplicate_of
 	FROM
 		feedback
 	WHERE
-		id = :id;
+		game_id = :game_id
+		AND submitted >= :since
+		AND description IS NOT NULL
+		AND description <> ''
+	ORDER BY
+		submitted DESC
+	LIMIT :limit
 `)
 	if err != nil {
-		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetFeedbackByID")
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetRecentFeedback")
 		return nil, err
 	}
 
-	srv.stmtMarkReadFeedback, err = srv.conn.PrepareNamed(`
+	srv.stmtMarkReadFeedback, err = srv.prepareNamed("stmtMarkReadFeedback", `
 	UPDATE feedback
 	SET read = true
-	WHERE id = :id
+	WHERE id = :id AND game_id = :game_id
 `)
 	if err != nil {
 		log.WithFields(log.Fields{"err": err}).Error("Failed stmtMarkReadFeedback")
 		return nil, err
 	}
 
-	srv.stmtNewUser, err = srv.conn.PrepareNamed(`
-	INSERT INTO usertable (
-		id,
-	    username,
-	    hash,
+	srv.stmtNewUser, err = srv.prepareNamed("stmtNewUser", `
+	WITH u AS (
+		INSERT INTO usertable (
+			id,
+		    username,
+		    hash,
+		    role
+		    ) VALUES (
+		    :id,
+			:username,
+		    :hash,
+		    :role
+		)
+		RETURNING id
+	)
+	INSERT INTO saves (
+		game_id,
+		account_id,
+	    slot,
 	    save_state,
-	    role
-	    ) VALUES (
-	    :id,
-		:username,
-	    :hash,
-	    :save_state,
-	    :role
+	    save_signature,
+	    save_version,
+	    updated
 	)
+	SELECT
+		:game_id,
+		u.id,
+	    :slot,
+	    :save_state,
+	    :save_signature,
+	    NULLIF(:save_version, ''),
+	    :updated
+	FROM u
 `)
 	if err != nil {
 		log.WithFields(log.Fields{"err": err}).Error("Failed stmtNewUser")
 		return nil, err
 	}
 
-	srv.stmtGetUserByID, err = srv.conn.PrepareNamed(`
+	srv.stmtGetUserByID, err = srv.prepareNamed("stmtGetUserByID", `
 	SELECT 
-	    id,
-		username,
-	    hash,
-	    save_state,
-	    role
+	    u.id,
+		u.username,
+	    u.hash,
+	    COALESCE(s.save_state, '') AS save_state,
+	    COALESCE(s.save_signature, '') AS save_signature,
+	    COALESCE(s.save_version, '') AS save_version,
+	    u.role
 	FROM
-		usertable
+		usertable u
+	LEFT JOIN
+		saves s ON s.game_id = :game_id AND s.account_id = u.id AND s.slot = :slot
 	WHERE
-		id = :id
+		u.id = :id
 `)
 	if err != nil {
 		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetUserByID")
 		return nil, err
 	}
 
-	srv.stmtGetUserByUsername, err = srv.conn.PrepareNamed(`
+	srv.stmtGetUserByUsername, err = srv.prepareNamed("stmtGetUserByUsername", `
 	SELECT 
-	    id,
-		username, 
-	    hash,
-	    save_state,
-	    role
+	    u.id,
+		u.username, 
+	    u.hash,
+	    COALESCE(s.save_state, '') AS save_state,
+	    COALESCE(s.save_signature, '') AS save_signature,
+	    COALESCE(s.save_version, '') AS save_version,
+	    u.role
 	FROM
-		usertable
+		usertable u
+	LEFT JOIN
+		saves s ON s.game_id = :game_id AND s.account_id = u.id AND s.slot = :slot
 	WHERE
-		username = :username
+		u.username = :username
 `)
 	if err != nil {
 		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetUserByUsername")
 		return nil, err
 	}
 
-	srv.stmtUpdateUser, err = srv.conn.PrepareNamed(`
-	UPDATE usertable
-	SET 
-	 hash = :hash,
-	 save_state = :save_state
-	WHERE id = :id
+	srv.stmtUpdateUser, err = srv.prepareNamed("stmtUpdateUser", `
+	WITH u AS (
+		UPDATE usertable
+		SET 
+		 hash = :hash
+		WHERE id = :id
+		RETURNING id
+	)
+	INSERT INTO saves (
+		game_id,
+		account_id,
+	    slot,
+	    save_state,
+	    save_signature,
+	    save_version,
+	    updated
+	)
+	SELECT
+		:game_id,
+		u.id,
+	    :slot,
+	    :save_state,
+	    :save_signature,
+	    NULLIF(:save_version, ''),
+	    :updated
+	FROM u
+	ON CONFLICT (game_id, account_id, slot) DO UPDATE
+	SET save_state = EXCLUDED.save_state,
+	    save_signature = EXCLUDED.save_signature,
+	    save_version = EXCLUDED.save_version,
+	    updated = EXCLUDED.updated
 `)
 	if err != nil {
 		log.WithFields(log.Fields{"err": err}).Error("Failed stmtUpdateUser")
 		return nil, err
 	}
 
-	srv.stmtElevateUser, err = srv.conn.PrepareNamed(`
+	srv.stmtElevateUser, err = srv.prepareNamed("stmtElevateUser", `
 	UPDATE usertable
 	SET
 	role = :role
@@ -195,7 +376,7 @@ func NewService(cfg *config.Config) (*Service, error) {
 		return nil, err
 	}
 
-	srv.stmtDeleteUser, err = srv.conn.PrepareNamed(`
+	srv.stmtDeleteUser, err = srv.prepareNamed("stmtDeleteUser", `
 	DELETE FROM usertable
 	WHERE id = :id
 `)
@@ -204,52 +385,211 @@ func NewService(cfg *config.Config) (*Service, error) {
 		return nil, err
 	}
 
+	srv.stmtInsertSaveFailure, err = srv.prepareNamed("stmtInsertSaveFailure", `
+	INSERT INTO save_verification_failures (
+		game_id,
+		account_id,
+	    reason,
+	    submitted
+	    ) VALUES (
+	    :game_id,
+	    :account_id,
+	    :reason,
+	    :submitted
+	)
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtInsertSaveFailure")
+		return nil, err
+	}
+
+	srv.stmtGetSaveFailureReport, err = srv.prepareNamed("stmtGetSaveFailureReport", `
+	SELECT
+		f.account_id,
+	    u.username,
+	    COUNT(*) AS failures,
+	    (ARRAY_AGG(f.reason ORDER BY f.submitted DESC))[1] AS last_reason,
+	    MAX(f.submitted) AS last_failure
+	FROM
+		save_verification_failures f
+	JOIN
+		usertable u ON u.id = f.account_id
+	WHERE
+		f.game_id = :game_id
+	GROUP BY
+		f.account_id, u.username
+	ORDER BY
+		last_failure DESC
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetSaveFailureReport")
+		return nil, err
+	}
+
+	if err := srv.prepareTriageStatements(); err != nil {
+		return nil, err
+	}
+
+	if err := srv.prepareAttachmentStatements(); err != nil {
+		return nil, err
+	}
+
+	if err := srv.prepareReplyStatements(); err != nil {
+		return nil, err
+	}
+
+	if err := srv.prepareSurveyStatements(); err != nil {
+		return nil, err
+	}
+
+	if err := srv.prepareWebhookStatements(); err != nil {
+		return nil, err
+	}
+
+	if err := srv.prepareSubscriptionStatements(); err != nil {
+		return nil, err
+	}
+
+	if err := srv.prepareDigestStatements(); err != nil {
+		return nil, err
+	}
+
+	if err := srv.prepareSaveStatements(); err != nil {
+		return nil, err
+	}
+
+	if err := srv.prepareDeviceStatements(); err != nil {
+		return nil, err
+	}
+
+	if err := srv.prepareGameStatements(); err != nil {
+		return nil, err
+	}
+
+	prepared = true
+	metrics.RegisterDB(conn.DB, cfg.Databases.Gamejam.Database)
 	return srv, nil
 }
 
-func (s *Service) InsertFeedback(feedback lemon_api.Feedback) (int64, error) {
+// Close releases the prepared statements and closes the connection pool,
+// waiting for queries in progress to finish.
+func (s *Service) Close() error {
+	for _, stmt := range s.stmts {
+		if err := stmt.Close(); err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Warn("Failed to close statement")
+		}
+	}
+	return s.conn.Close()
+}
+
+// WithContext returns a copy of the service whose queries run under ctx, so
+// they are cancelled with it and their spans join its trace.
+func (s *Service) WithContext(ctx context.Context) *Service {
+	scoped := *s
+	scoped.ctx = ctx
+	return &scoped
+}
+
+// prepareNamed prepares a statement and remembers it so Close can release it.
+// Its query durations are recorded under name.
+func (srv *Service) prepareNamed(name string, query string) (*sqlx.NamedStmt, error) {
+	stmt, err := srv.conn.PrepareNamed(query)
+	if err != nil {
+		return nil, err
+	}
+	nameStatement(name, stmt.QueryString)
+	srv.stmts = append(srv.stmts, stmt)
+	return stmt, nil
+}
+
+// InsertFeedback stores feedback with its already uploaded attachments and,
+// in the same transaction, queues its feedback.created webhooks so no
+// notification is lost. Quarantined feedback is stored without notifying
+// anyone.
+func (s *Service) InsertFeedback(feedback lemon_api.Feedback, attachments []lemon_api.FeedbackAttachment, notifiers []string) (int64, error) {
 	now := time.Now().UTC()
 	feedback.Submitted = &now
+
+	tx, err := s.conn.BeginTxx(s.ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	var returnID int64
-	err := s.stmtInsertFeedback.QueryRow(feedback).Scan(&returnID)
-	return returnID, err
+	err = tx.NamedStmt(s.stmtInsertFeedback).QueryRowContext(s.ctx, feedback).Scan(&returnID)
+	if err != nil {
+		return 0, err
+	}
+
+	feedback.ID = returnID
+	for _, attachment := range attachments {
+		attachment.FeedbackID = returnID
+		attachment.Created = &now
+		if _, err := tx.NamedStmt(s.stmtInsertFeedbackAttachment).ExecContext(s.ctx, attachment); err != nil {
+			return 0, err
+		}
+	}
+
+	if feedback.Status != lemon_api.FeedbackStatusQuarantined {
+		if err := s.enqueueWebhooks(tx, feedback.GameID, lemon_api.WebhookEventFeedbackCreated, notifiers, feedback); err != nil {
+			return 0, err
+		}
+	}
+
+	return returnID, tx.Commit()
 }
 
-func (s *Service) GetFeedback() ([]*lemon_api.Feedback, error) {
-	var feedback []*lemon_api.Feedback
-	query := struct{}{}
-	err := s.stmtGetFeedback.Select(&feedback, query)
+func (s *Service) GetFeedbackByID(gameID string, ID int64) (*lemon_api.Feedback, error) {
+	var feedback lemon_api.Feedback
+	query := struct {
+		ID     int64  `db:"id"`
+		GameID string `db:"game_id"`
+	}{ID: ID, GameID: gameID}
+	err := s.stmtGetFeedbackByID.GetContext(s.ctx, &feedback, query)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
-		}).Error("Failed to Select GetFeedback")
+		}).Error("Failed to Get GetFeedbackByID")
 		return nil, err
 	}
-	return feedback, err
+	return &feedback, err
 }
 
-func (s *Service) GetFeedbackByID(ID int64) (*lemon_api.Feedback, error) {
-	var feedback lemon_api.Feedback
+// GetRecentFeedback returns the latest feedback with a description submitted
+// since the given time, for comparing new submissions against.
+func (s *Service) GetRecentFeedback(gameID string, since time.Time, limit int) ([]*lemon_api.Feedback, error) {
+	var feedback []*lemon_api.Feedback
 	query := struct {
-		ID int64 `db:"id"`
-	}{ID: ID}
-	err := s.stmtGetFeedback.Get(&feedback, query)
+		GameID string    `db:"game_id"`
+		Since  time.Time `db:"since"`
+		Limit  int       `db:"limit"`
+	}{
+		GameID: gameID,
+		Since:  since,
+		Limit:  limit,
+	}
+	err := s.stmtGetRecentFeedback.SelectContext(s.ctx, &feedback, query)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
-		}).Error("Failed to Get GetFeedbackByID")
+		}).Error("Failed to Select GetRecentFeedback")
 		return nil, err
 	}
-	return &feedback, err
+	return feedback, nil
 }
 
-func (s *Service) MarkReadFeedback(ID int64) error {
+func (s *Service) MarkReadFeedback(gameID string, ID int64) error {
 	query := struct {
-		ID int64 `db:"id"`
+		ID     int64  `db:"id"`
+		GameID string `db:"game_id"`
 	}{
-		ID: ID,
+		ID:     ID,
+		GameID: gameID,
 	}
-	_, err := s.stmtMarkReadFeedback.Exec(query)
+	_, err := s.stmtMarkReadFeedback.ExecContext(s.ctx, query)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
@@ -259,35 +599,69 @@ func (s *Service) MarkReadFeedback(ID int64) error {
 	return nil
 }
 
-func (s *Service) NewUser(user lemon_api.User) (sql.Result, error) {
+// NewUser creates an account with its default save and queues its
+// user.registered webhooks in the same transaction.
+func (s *Service) NewUser(gameID string, user lemon_api.User, notifiers []string) (sql.Result, error) {
+	now := time.Now().UTC()
 	query := struct {
-		ID            string `db:"id"`
-		Username      string `db:"username"`
-		Hash          string `db:"hash"`
-		SaveState     string `db:"save_state"`
-		Role	      string `db:"role"`
-		EncryptionKey string `db:"encrypt_key"`
+		GameID        string     `db:"game_id"`
+		ID            string     `db:"id"`
+		Username      string     `db:"username"`
+		Hash          string     `db:"hash"`
+		Slot          string     `db:"slot"`
+		SaveState     string     `db:"save_state"`
+		Signature     string     `db:"save_signature"`
+		SaveVersion   string     `db:"save_version"`
+		Updated       *time.Time `db:"updated"`
+		Role	      string     `db:"role"`
+		EncryptionKey string     `db:"encrypt_key"`
 	}{
+		GameID:        gameID,
 		ID:            user.ID,
 		Username:      user.Username,
 		Hash:          user.Hash,
+		Slot:          lemon_api.DefaultSaveSlot,
 		SaveState:     user.SaveState,
+		Signature:     user.Signature,
+		SaveVersion:   user.SaveVersion,
+		Updated:       &now,
 		Role: 		user.Role,
 		EncryptionKey: s.encryptionKey,
 	}
-	return s.stmtNewUser.Exec(query)
+
+	tx, err := s.conn.BeginTxx(s.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.NamedStmt(s.stmtNewUser).ExecContext(s.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	event := lemon_api.UserRegisteredEvent{ID: user.ID, Username: user.Username}
+	if err := s.enqueueWebhooks(tx, gameID, lemon_api.WebhookEventUserRegistered, notifiers, event); err != nil {
+		return nil, err
+	}
+
+	return result, tx.Commit()
 }
 
-func (s *Service) GetUserByID(ID string) (*lemon_api.User, error) {
+func (s *Service) GetUserByID(gameID string, ID string) (*lemon_api.User, error) {
 	var user lemon_api.User
 	query := struct {
+		GameID        string `db:"game_id"`
 		ID            string `db:"id"`
+		Slot          string `db:"slot"`
 		EncryptionKey string `db:"encrypt_key"`
 	}{
+		GameID:        gameID,
 		ID:            ID,
+		Slot:          lemon_api.DefaultSaveSlot,
 		EncryptionKey: s.encryptionKey,
 	}
-	err := s.stmtGetUserByID.Get(&user, query)
+	err := s.stmtGetUserByID.GetContext(s.ctx, &user, query)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
@@ -297,16 +671,20 @@ func (s *Service) GetUserByID(ID string) (*lemon_api.User, error) {
 	return &user, err
 }
 
-func (s *Service) GetUserByUsername(username string) (*lemon_api.User, error) {
+func (s *Service) GetUserByUsername(gameID string, username string) (*lemon_api.User, error) {
 	var user lemon_api.User
 	query := struct {
+		GameID        string `db:"game_id"`
 		Username      string `db:"username"`
+		Slot          string `db:"slot"`
 		EncryptionKey string `db:"encrypt_key"`
 	}{
+		GameID:        gameID,
 		Username:      username,
+		Slot:          lemon_api.DefaultSaveSlot,
 		EncryptionKey: s.encryptionKey,
 	}
-	err := s.stmtGetUserByUsername.Get(&user, query)
+	err := s.stmtGetUserByUsername.GetContext(s.ctx, &user, query)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
@@ -316,26 +694,57 @@ func (s *Service) GetUserByUsername(username string) (*lemon_api.User, error) {
 	return &user, err
 }
 
-func (s *Service) UpdateUser(user lemon_api.User) error {
+// UpdateUser saves the account's password hash and default save, queueing
+// save.updated webhooks in the same transaction.
+func (s *Service) UpdateUser(gameID string, user lemon_api.User, notifiers []string) error {
+	now := time.Now().UTC()
 	query := struct {
-		ID            string `db:"id"`
-		Hash          string `db:"hash"`
-		SaveState     string `db:"save_state"`
-		EncryptionKey string `db:"encrypt_key"`
+		GameID        string     `db:"game_id"`
+		ID            string     `db:"id"`
+		Hash          string     `db:"hash"`
+		Slot          string     `db:"slot"`
+		SaveState     string     `db:"save_state"`
+		Signature     string     `db:"save_signature"`
+		SaveVersion   string     `db:"save_version"`
+		Updated       *time.Time `db:"updated"`
+		EncryptionKey string     `db:"encrypt_key"`
 	}{
+		GameID:        gameID,
 		ID:            user.ID,
 		Hash:          user.Hash,
+		Slot:          lemon_api.DefaultSaveSlot,
 		SaveState:     user.SaveState,
+		Signature:     user.Signature,
+		SaveVersion:   user.SaveVersion,
+		Updated:       &now,
 		EncryptionKey: s.encryptionKey,
 	}
-	_, err := s.stmtUpdateUser.Exec(query)
+
+	tx, err := s.conn.BeginTxx(s.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.NamedStmt(s.stmtUpdateUser).ExecContext(s.ctx, query)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
 		}).Error("Failed to Exec UpdateUser")
 		return err
 	}
-	return nil
+
+	event := lemon_api.SaveUpdatedEvent{
+		AccountID:   user.ID,
+		Slot:        lemon_api.DefaultSaveSlot,
+		SaveVersion: user.SaveVersion,
+		Updated:     &now,
+	}
+	if err := s.enqueueWebhooks(tx, gameID, lemon_api.WebhookEventSaveUpdated, notifiers, event); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (s *Service) ElevateUser(user lemon_api.User) error {
@@ -346,7 +755,7 @@ func (s *Service) ElevateUser(user lemon_api.User) error {
 		ID:            user.ID,
 		Role: 			user.Role,
 	}
-	_, err := s.stmtElevateUser.Exec(query)
+	_, err := s.stmtElevateUser.ExecContext(s.ctx, query)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
@@ -362,7 +771,7 @@ func (s *Service) DeleteUser(ID string) error {
 	}{
 		ID: ID,
 	}
-	_, err := s.stmtDeleteUser.Exec(query)
+	_, err := s.stmtDeleteUser.ExecContext(s.ctx, query)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
@@ -371,3 +780,41 @@ func (s *Service) DeleteUser(ID string) error {
 	}
 	return nil
 }
+
+func (s *Service) InsertSaveFailure(gameID string, accountID string, reason string) error {
+	now := time.Now().UTC()
+	query := struct {
+		GameID    string     `db:"game_id"`
+		AccountID string     `db:"account_id"`
+		Reason    string     `db:"reason"`
+		Submitted *time.Time `db:"submitted"`
+	}{
+		GameID:    gameID,
+		AccountID: accountID,
+		Reason:    reason,
+		Submitted: &now,
+	}
+	_, err := s.stmtInsertSaveFailure.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec InsertSaveFailure")
+		return err
+	}
+	return nil
+}
+
+func (s *Service) GetSaveFailureReport(gameID string) ([]*lemon_api.SaveVerificationReport, error) {
+	var report []*lemon_api.SaveVerificationReport
+	query := struct {
+		GameID string `db:"game_id"`
+	}{GameID: gameID}
+	err := s.stmtGetSaveFailureReport.SelectContext(s.ctx, &report, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetSaveFailureReport")
+		return nil, err
+	}
+	return report, err
+}
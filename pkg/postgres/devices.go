@@ -0,0 +1,201 @@
+package postgres
+
+import (
+	lemon_api "lemon/lemon-api"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func (srv *Service) prepareDeviceStatements() error {
+	var err error
+
+	srv.stmtInsertDeviceCode, err = srv.prepareNamed("stmtInsertDeviceCode", `
+	INSERT INTO device_codes (
+		device_code,
+	    user_code,
+	    status,
+	    created,
+	    expires
+	    ) VALUES (
+	    :device_code,
+	    :user_code,
+	    :status,
+	    :created,
+	    :expires
+	)
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtInsertDeviceCode")
+		return err
+	}
+
+	srv.stmtGetDeviceCode, err = srv.prepareNamed("stmtGetDeviceCode", `
+	SELECT
+		device_code,
+	    user_code,
+	    COALESCE(account_id, '') AS account_id,
+	    status,
+	    created,
+	    expires,
+	    last_polled
+	FROM
+		device_codes
+	WHERE
+		device_code = :device_code
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetDeviceCode")
+		return err
+	}
+
+	srv.stmtPollDeviceCode, err = srv.prepareNamed("stmtPollDeviceCode", `
+	UPDATE device_codes
+	SET last_polled = :now
+	WHERE device_code = :device_code
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtPollDeviceCode")
+		return err
+	}
+
+	srv.stmtResolveDeviceCode, err = srv.prepareNamed("stmtResolveDeviceCode", `
+	UPDATE device_codes
+	SET
+		status = :status,
+	    account_id = :account_id
+	WHERE
+		user_code = :user_code
+		AND status = 'PENDING'
+		AND expires > :now
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtResolveDeviceCode")
+		return err
+	}
+
+	srv.stmtConsumeDeviceCode, err = srv.prepareNamed("stmtConsumeDeviceCode", `
+	UPDATE device_codes
+	SET status = 'CONSUMED'
+	WHERE
+		device_code = :device_code
+		AND status = 'APPROVED'
+		AND expires > :now
+	RETURNING account_id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtConsumeDeviceCode")
+		return err
+	}
+
+	srv.stmtDeleteExpiredDeviceCodes, err = srv.prepareNamed("stmtDeleteExpiredDeviceCodes", `
+	DELETE FROM device_codes
+	WHERE expires < :now
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtDeleteExpiredDeviceCodes")
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) InsertDeviceCode(code lemon_api.DeviceCode) error {
+	_, err := s.stmtInsertDeviceCode.ExecContext(s.ctx, code)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec InsertDeviceCode")
+		return err
+	}
+	return nil
+}
+
+func (s *Service) GetDeviceCode(deviceCode string) (*lemon_api.DeviceCode, error) {
+	var code lemon_api.DeviceCode
+	query := struct {
+		DeviceCode string `db:"device_code"`
+	}{
+		DeviceCode: deviceCode,
+	}
+	err := s.stmtGetDeviceCode.GetContext(s.ctx, &code, query)
+	if err != nil {
+		return nil, err
+	}
+	return &code, err
+}
+
+func (s *Service) PollDeviceCode(deviceCode string) error {
+	query := struct {
+		DeviceCode string    `db:"device_code"`
+		Now        time.Time `db:"now"`
+	}{
+		DeviceCode: deviceCode,
+		Now:        time.Now().UTC(),
+	}
+	_, err := s.stmtPollDeviceCode.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec PollDeviceCode")
+		return err
+	}
+	return nil
+}
+
+// ResolveDeviceCode approves or denies a pending user code on behalf of an
+// account. It reports false if the code is unknown, expired or already used.
+func (s *Service) ResolveDeviceCode(userCode string, accountID string, status string) (bool, error) {
+	query := struct {
+		UserCode  string    `db:"user_code"`
+		AccountID string    `db:"account_id"`
+		Status    string    `db:"status"`
+		Now       time.Time `db:"now"`
+	}{
+		UserCode:  userCode,
+		AccountID: accountID,
+		Status:    status,
+		Now:       time.Now().UTC(),
+	}
+	result, err := s.stmtResolveDeviceCode.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec ResolveDeviceCode")
+		return false, err
+	}
+	resolved, err := result.RowsAffected()
+	return resolved > 0, err
+}
+
+// ConsumeDeviceCode marks an approved device code as used and returns the
+// account it was approved for. It returns sql.ErrNoRows if there is nothing to
+// hand out, so a code can only ever be exchanged for one token.
+func (s *Service) ConsumeDeviceCode(deviceCode string) (string, error) {
+	var accountID string
+	query := struct {
+		DeviceCode string    `db:"device_code"`
+		Now        time.Time `db:"now"`
+	}{
+		DeviceCode: deviceCode,
+		Now:        time.Now().UTC(),
+	}
+	err := s.stmtConsumeDeviceCode.GetContext(s.ctx, &accountID, query)
+	return accountID, err
+}
+
+func (s *Service) DeleteExpiredDeviceCodes() error {
+	query := struct {
+		Now time.Time `db:"now"`
+	}{
+		Now: time.Now().UTC(),
+	}
+	_, err := s.stmtDeleteExpiredDeviceCodes.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec DeleteExpiredDeviceCodes")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	lemon_api "lemon/lemon-api"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// digestLimit is how many types and lowest rated feedback a digest lists.
+const digestLimit = 3
+
+func (srv *Service) prepareDigestStatements() error {
+	var err error
+
+	// Claiming a period first means only one API instance sends each digest,
+	// and a restart doesn't send it again.
+	srv.stmtClaimDigest, err = srv.prepareNamed("stmtClaimDigest", `
+	INSERT INTO feedback_digests (
+		game_id,
+	    period,
+	    period_start,
+	    period_end,
+	    created
+	    ) VALUES (
+	    :game_id,
+	    :period,
+	    :from,
+	    :to,
+	    :created
+	)
+	ON CONFLICT DO NOTHING
+	RETURNING id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtClaimDigest")
+		return err
+	}
+
+	srv.stmtGetDigestGames, err = srv.prepareNamed("stmtGetDigestGames", `
+	SELECT DISTINCT
+		game_id
+	FROM
+		feedback
+	WHERE
+		submitted >= :from AND submitted < :to
+		AND status <> '`+lemon_api.FeedbackStatusQuarantined+`'
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetDigestGames")
+		return err
+	}
+
+	srv.stmtGetDigestTotals, err = srv.prepareNamed("stmtGetDigestTotals", `
+	SELECT
+		COUNT(*) AS count,
+		COALESCE(AVG(rating), 0) AS average_rating
+	FROM
+		feedback
+	WHERE
+		game_id = :game_id
+		AND submitted >= :from AND submitted < :to
+		AND status <> '`+lemon_api.FeedbackStatusQuarantined+`'
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetDigestTotals")
+		return err
+	}
+
+	srv.stmtGetDigestTypes, err = srv.prepareNamed("stmtGetDigestTypes", `
+	SELECT
+		COALESCE(type, '') AS type,
+		COUNT(*) AS count,
+		COUNT(*) FILTER (WHERE NOT read) AS unread
+	FROM
+		feedback
+	WHERE
+		game_id = :game_id
+		AND submitted >= :from AND submitted < :to
+		AND status <> '`+lemon_api.FeedbackStatusQuarantined+`'
+	GROUP BY
+		type
+	ORDER BY
+		count DESC, type
+	LIMIT :limit
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetDigestTypes")
+		return err
+	}
+
+	srv.stmtGetDigestLowest, err = srv.prepareNamed("stmtGetDigestLowest", `
+	SELECT
+		id,
+		account_id,
+		rating,
+	    description,
+	    type,
+	    COALESCE(build, '') AS build,
+	    metadata,
+	    submitted,
+	    read,
+	    status,
+	    assignee_id,
+	    duplicate_of
+	FROM
+		feedback
+	WHERE
+		game_id = :game_id
+		AND submitted >= :from AND submitted < :to
+		AND status <> '`+lemon_api.FeedbackStatusQuarantined+`'
+	ORDER BY
+		rating, submitted, id
+	LIMIT :limit
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetDigestLowest")
+		return err
+	}
+
+	return nil
+}
+
+// GetDigestGames lists the games that had feedback between from and to, which
+// are the only ones with anything to put in a digest.
+func (s *Service) GetDigestGames(from time.Time, to time.Time) ([]string, error) {
+	var games []string
+	query := struct {
+		From time.Time `db:"from"`
+		To   time.Time `db:"to"`
+	}{
+		From: from,
+		To:   to,
+	}
+	err := s.stmtGetDigestGames.SelectContext(s.ctx, &games, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetDigestGames")
+		return nil, err
+	}
+	return games, nil
+}
+
+// EnqueueFeedbackDigest summarises a game's feedback between from and to and
+// queues it for the notifiers that take period's digest. It returns nil if the
+// digest was already sent, or there was nothing to put in it.
+func (s *Service) EnqueueFeedbackDigest(gameID string, period string, from time.Time, to time.Time, notifiers []string) (*lemon_api.FeedbackDigest, error) {
+	now := time.Now().UTC()
+	query := struct {
+		GameID  string    `db:"game_id"`
+		Period  string    `db:"period"`
+		From    time.Time `db:"from"`
+		To      time.Time `db:"to"`
+		Limit   int       `db:"limit"`
+		Created time.Time `db:"created"`
+	}{
+		GameID:  gameID,
+		Period:  period,
+		From:    from,
+		To:      to,
+		Limit:   digestLimit,
+		Created: now,
+	}
+
+	tx, err := s.conn.BeginTxx(s.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ID int64
+	if err := tx.NamedStmt(s.stmtClaimDigest).GetContext(s.ctx, &ID, query); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Get ClaimDigest")
+		return nil, err
+	}
+
+	digest := lemon_api.FeedbackDigest{
+		Period: period,
+		From:   &from,
+		To:     &to,
+		Types:  []*lemon_api.FeedbackTypeStat{},
+		Lowest: []*lemon_api.Feedback{},
+	}
+	if err := tx.NamedStmt(s.stmtGetDigestTotals).GetContext(s.ctx, &digest, query); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Get GetDigestTotals")
+		return nil, err
+	}
+	if digest.Count == 0 {
+		return nil, tx.Commit()
+	}
+	if err := tx.NamedStmt(s.stmtGetDigestTypes).SelectContext(s.ctx, &digest.Types, query); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetDigestTypes")
+		return nil, err
+	}
+	if err := tx.NamedStmt(s.stmtGetDigestLowest).SelectContext(s.ctx, &digest.Lowest, query); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetDigestLowest")
+		return nil, err
+	}
+
+	b, err := json.Marshal(digest)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.enqueueNotifiers(tx, gameID, lemon_api.WebhookEventFeedbackDigest, notifiers, b, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &digest, nil
+}
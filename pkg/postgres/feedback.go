@@ -0,0 +1,466 @@
+package postgres
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	lemon_api "lemon/lemon-api"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort")
+)
+
+const (
+	defaultFeedbackLimit = 50
+	maxFeedbackLimit     = 200
+)
+
+// feedbackSortColumns maps the sort options clients may ask for onto indexed
+// columns. Every ordering breaks ties on id so cursors are stable.
+var feedbackSortColumns = map[string]string{
+	lemon_api.FeedbackSortSubmitted: "submitted",
+	lemon_api.FeedbackSortRating:    "rating",
+	lemon_api.FeedbackSortID:        "id",
+}
+
+// feedbackCursor is the position after the last row of a page, base64 encoded
+// before it is handed to clients.
+type feedbackCursor struct {
+	Value json.RawMessage `json:"v,omitempty"`
+	ID    int64           `json:"id"`
+}
+
+// feedbackConditions builds the WHERE clause shared by every query over a
+// filtered set of feedback, so listing, counting and exporting agree.
+// Quarantined feedback is only included when the filter asks for it by status,
+// which only developers may do.
+func feedbackConditions(filter lemon_api.FeedbackFilter) (string, map[string]interface{}) {
+	conditions := []string{"game_id = :game_id"}
+	args := map[string]interface{}{
+		"game_id": filter.GameID,
+	}
+
+	if filter.Type != "" {
+		conditions = append(conditions, "type = :type")
+		args["type"] = filter.Type
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = :status")
+		args["status"] = filter.Status
+	} else {
+		conditions = append(conditions, "status <> '"+lemon_api.FeedbackStatusQuarantined+"'")
+	}
+	if filter.Build != "" {
+		conditions = append(conditions, "build = :build")
+		args["build"] = filter.Build
+	}
+	if metadata := filterMetadata(filter); metadata != "" {
+		conditions = append(conditions, "metadata @> CAST(:metadata AS jsonb)")
+		args["metadata"] = metadata
+	}
+	if filter.MinRating != nil {
+		conditions = append(conditions, "rating >= :min_rating")
+		args["min_rating"] = *filter.MinRating
+	}
+	if filter.MaxRating != nil {
+		conditions = append(conditions, "rating <= :max_rating")
+		args["max_rating"] = *filter.MaxRating
+	}
+	if filter.Read != nil {
+		conditions = append(conditions, "read = :read")
+		args["read"] = *filter.Read
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "submitted >= :from")
+		args["from"] = *filter.From
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "submitted < :to")
+		args["to"] = *filter.To
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// filterMetadata builds the JSON document feedback metadata must contain to
+// match the filter, or "" when the filter doesn't look at metadata. Matching
+// by containment lets the GIN index on metadata serve every combination.
+func filterMetadata(filter lemon_api.FeedbackFilter) string {
+	metadata := lemon_api.FeedbackMetadata{
+		Platform:  filter.Platform,
+		Locale:    filter.Locale,
+		Scene:     filter.Scene,
+		SessionID: filter.SessionID,
+		Context:   filter.Context,
+	}
+	if metadata.Platform == "" && metadata.Locale == "" && metadata.Scene == "" &&
+		metadata.SessionID == "" && len(metadata.Context) == 0 {
+		return ""
+	}
+
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// feedbackOrder validates the requested sort and returns the column and
+// direction to order by.
+func feedbackOrder(filter lemon_api.FeedbackFilter) (string, string, error) {
+	sort := filter.Sort
+	if sort == "" {
+		sort = lemon_api.FeedbackSortSubmitted
+	}
+	column, ok := feedbackSortColumns[sort]
+	if !ok {
+		return "", "", ErrInvalidSort
+	}
+
+	switch strings.ToLower(filter.Order) {
+	case "", "desc":
+		return column, "DESC", nil
+	case "asc":
+		return column, "ASC", nil
+	default:
+		return "", "", ErrInvalidSort
+	}
+}
+
+// ListFeedback returns one page of feedback matching the filter and the cursor
+// for the following page, which is empty on the last page.
+func (s *Service) ListFeedback(filter lemon_api.FeedbackFilter) ([]*lemon_api.Feedback, string, error) {
+	column, direction, err := feedbackOrder(filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where, args := feedbackConditions(filter)
+
+	if filter.Cursor != "" {
+		cursor, err := decodeFeedbackCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		comparison := "<"
+		if direction == "ASC" {
+			comparison = ">"
+		}
+
+		args["cursor_id"] = cursor.ID
+		if column == "id" {
+			where += " AND id " + comparison + " :cursor_id"
+		} else {
+			value, err := cursorValue(column, cursor.Value)
+			if err != nil {
+				return nil, "", err
+			}
+			args["cursor_value"] = value
+			where += " AND (" + column + ", id) " + comparison + " (:cursor_value, :cursor_id)"
+		}
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultFeedbackLimit
+	}
+	if limit > maxFeedbackLimit {
+		limit = maxFeedbackLimit
+	}
+	args["limit"] = limit + 1
+
+	orderBy := column + " " + direction
+	if column != "id" {
+		orderBy += ", id " + direction
+	}
+
+	query, queryArgs, err := sqlx.Named(`
+	SELECT
+		id,
+		rating,
+	    description,
+	    type,
+	    account_id,
+	    COALESCE(build, '') AS build,
+	    metadata,
+	    submitted,
+	    read,
+	    status,
+	    assignee_id,
+	    duplicate_of,
+	    quarantine_reason
+	FROM
+		feedback
+	WHERE
+		`+where+`
+	ORDER BY
+		`+orderBy+`
+	LIMIT :limit
+`, args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var feedback []*lemon_api.Feedback
+	err = s.conn.SelectContext(s.ctx, &feedback, s.conn.Rebind(query), queryArgs...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select ListFeedback")
+		return nil, "", err
+	}
+
+	if len(feedback) <= limit {
+		return feedback, "", nil
+	}
+
+	feedback = feedback[:limit]
+	next, err := encodeFeedbackCursor(column, feedback[limit-1])
+	if err != nil {
+		return nil, "", err
+	}
+	return feedback, next, nil
+}
+
+// ExportFeedback streams every row matching the filter to fn in the filter's
+// sort order, ignoring limit and cursor. Rows are read one at a time so large
+// exports don't have to fit in memory. An error from fn stops the export.
+func (s *Service) ExportFeedback(filter lemon_api.FeedbackFilter, fn func(*lemon_api.Feedback) error) error {
+	column, direction, err := feedbackOrder(filter)
+	if err != nil {
+		return err
+	}
+
+	where, args := feedbackConditions(filter)
+
+	orderBy := column + " " + direction
+	if column != "id" {
+		orderBy += ", id " + direction
+	}
+
+	query, queryArgs, err := sqlx.Named(`
+	SELECT
+		id,
+		account_id,
+		rating,
+	    description,
+	    type,
+	    COALESCE(build, '') AS build,
+	    metadata,
+	    submitted,
+	    read,
+	    status,
+	    assignee_id,
+	    duplicate_of,
+	    quarantine_reason
+	FROM
+		feedback
+	WHERE
+		`+where+`
+	ORDER BY
+		`+orderBy, args)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.conn.QueryxContext(s.ctx, s.conn.Rebind(query), queryArgs...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Queryx ExportFeedback")
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var feedback lemon_api.Feedback
+		if err := rows.StructScan(&feedback); err != nil {
+			return err
+		}
+		if err := fn(&feedback); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CountFeedback counts every row matching the filter, ignoring pagination.
+func (s *Service) CountFeedback(filter lemon_api.FeedbackFilter) (int64, error) {
+	where, args := feedbackConditions(filter)
+
+	query, queryArgs, err := sqlx.Named(`
+	SELECT
+		COUNT(*)
+	FROM
+		feedback
+	WHERE
+		`+where, args)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err = s.conn.GetContext(s.ctx, &count, s.conn.Rebind(query), queryArgs...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Get CountFeedback")
+		return 0, err
+	}
+	return count, nil
+}
+
+func encodeFeedbackCursor(column string, last *lemon_api.Feedback) (string, error) {
+	cursor := feedbackCursor{ID: last.ID}
+
+	var value interface{}
+	switch column {
+	case "submitted":
+		value = last.Submitted.UTC().Format(time.RFC3339Nano)
+	case "rating":
+		value = last.Rating
+	}
+
+	if value != nil {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		cursor.Value = b
+	}
+
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeFeedbackCursor(encoded string) (*feedbackCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor feedbackCursor
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+func cursorValue(column string, raw json.RawMessage) (interface{}, error) {
+	switch column {
+	case "submitted":
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		submitted, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return submitted, nil
+	case "rating":
+		var value int64
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return value, nil
+	}
+	return nil, ErrInvalidCursor
+}
+
+// escapedDescription is the feedback description with HTML special characters
+// escaped, so players can't get markup into search snippets.
+const escapedDescription = `REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(COALESCE(description, ''),
+	        '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`
+
+// SearchFeedback runs a full text search over feedback descriptions within the
+// filter, best matches first. Snippets are HTML: the description is escaped
+// and matched terms are wrapped in <mark> tags.
+func (s *Service) SearchFeedback(filter lemon_api.FeedbackFilter, search string, offset int) ([]*lemon_api.FeedbackSearchResult, int64, error) {
+	where, args := feedbackConditions(filter)
+	where += " AND search @@ websearch_to_tsquery('english', :search)"
+	args["search"] = search
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultFeedbackLimit
+	}
+	if limit > maxFeedbackLimit {
+		limit = maxFeedbackLimit
+	}
+	args["limit"] = limit
+	args["offset"] = offset
+
+	query, queryArgs, err := sqlx.Named(`
+	SELECT
+		id,
+		rating,
+	    description,
+	    type,
+	    account_id,
+	    COALESCE(build, '') AS build,
+	    metadata,
+	    submitted,
+	    read,
+	    status,
+	    assignee_id,
+	    duplicate_of,
+	    quarantine_reason,
+	    ts_rank(search, websearch_to_tsquery('english', :search)) AS rank,
+	    ts_headline('english', `+escapedDescription+`, websearch_to_tsquery('english', :search),
+	        'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5') AS snippet
+	FROM
+		feedback
+	WHERE
+		`+where+`
+	ORDER BY
+		rank DESC, id DESC
+	LIMIT :limit
+	OFFSET :offset
+`, args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var results []*lemon_api.FeedbackSearchResult
+	err = s.conn.SelectContext(s.ctx, &results, s.conn.Rebind(query), queryArgs...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select SearchFeedback")
+		return nil, 0, err
+	}
+
+	countQuery, countArgs, err := sqlx.Named(`
+	SELECT
+		COUNT(*)
+	FROM
+		feedback
+	WHERE
+		`+where, args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	err = s.conn.GetContext(s.ctx, &total, s.conn.Rebind(countQuery), countArgs...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Get SearchFeedback count")
+		return nil, 0, err
+	}
+
+	return results, total, nil
+}
@@ -0,0 +1,289 @@
+package postgres
+
+import (
+	lemon_api "lemon/lemon-api"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func (srv *Service) prepareGameStatements() error {
+	var err error
+
+	srv.stmtInsertGame, err = srv.prepareNamed("stmtInsertGame", `
+	INSERT INTO games (
+		id,
+	    slug,
+	    name,
+	    api_key,
+	    sharing_enabled,
+	    created
+	    ) VALUES (
+	    :id,
+	    :slug,
+	    :name,
+	    :api_key,
+	    :sharing_enabled,
+	    :created
+	)
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtInsertGame")
+		return err
+	}
+
+	srv.stmtGetGameBySlug, err = srv.prepareNamed("stmtGetGameBySlug", `
+	SELECT
+		id,
+	    slug,
+	    name,
+	    api_key,
+	    sharing_enabled,
+	    created
+	FROM
+		games
+	WHERE
+		slug = :slug
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetGameBySlug")
+		return err
+	}
+
+	srv.stmtGetGameByAPIKey, err = srv.prepareNamed("stmtGetGameByAPIKey", `
+	SELECT
+		id,
+	    slug,
+	    name,
+	    api_key,
+	    sharing_enabled,
+	    created
+	FROM
+		games
+	WHERE
+		api_key = :api_key
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetGameByAPIKey")
+		return err
+	}
+
+	srv.stmtGetDeveloperGames, err = srv.prepareNamed("stmtGetDeveloperGames", `
+	SELECT
+		g.id,
+	    g.slug,
+	    g.name,
+	    g.api_key,
+	    g.sharing_enabled,
+	    g.created
+	FROM
+		games g
+	JOIN
+		game_developers d ON d.game_id = g.id
+	WHERE
+		d.account_id = :account_id
+	ORDER BY
+		g.created
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetDeveloperGames")
+		return err
+	}
+
+	srv.stmtUpdateGameSharing, err = srv.prepareNamed("stmtUpdateGameSharing", `
+	UPDATE games
+	SET sharing_enabled = :sharing_enabled
+	WHERE id = :id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtUpdateGameSharing")
+		return err
+	}
+
+	srv.stmtAddGameDeveloper, err = srv.prepareNamed("stmtAddGameDeveloper", `
+	INSERT INTO game_developers (
+		game_id,
+	    account_id
+	    ) VALUES (
+	    :game_id,
+	    :account_id
+	)
+	ON CONFLICT DO NOTHING
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtAddGameDeveloper")
+		return err
+	}
+
+	srv.stmtRemoveGameDeveloper, err = srv.prepareNamed("stmtRemoveGameDeveloper", `
+	DELETE FROM game_developers
+	WHERE game_id = :game_id AND account_id = :account_id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtRemoveGameDeveloper")
+		return err
+	}
+
+	srv.stmtIsGameDeveloper, err = srv.prepareNamed("stmtIsGameDeveloper", `
+	SELECT EXISTS (
+		SELECT 1
+		FROM game_developers
+		WHERE game_id = :game_id AND account_id = :account_id
+	)
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtIsGameDeveloper")
+		return err
+	}
+
+	return nil
+}
+
+// InsertGame creates a game and makes the creating account its first developer.
+func (s *Service) InsertGame(game lemon_api.Game, accountID string) error {
+	tx, err := s.conn.BeginTxx(s.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.NamedStmt(s.stmtInsertGame).ExecContext(s.ctx, game); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec InsertGame")
+		return err
+	}
+
+	query := struct {
+		GameID    string `db:"game_id"`
+		AccountID string `db:"account_id"`
+	}{
+		GameID:    game.ID,
+		AccountID: accountID,
+	}
+	if _, err := tx.NamedStmt(s.stmtAddGameDeveloper).ExecContext(s.ctx, query); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec AddGameDeveloper for InsertGame")
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Service) GetGameBySlug(slug string) (*lemon_api.Game, error) {
+	var game lemon_api.Game
+	query := struct {
+		Slug string `db:"slug"`
+	}{
+		Slug: slug,
+	}
+	err := s.stmtGetGameBySlug.GetContext(s.ctx, &game, query)
+	if err != nil {
+		return nil, err
+	}
+	return &game, err
+}
+
+func (s *Service) GetGameByAPIKey(apiKey string) (*lemon_api.Game, error) {
+	var game lemon_api.Game
+	query := struct {
+		APIKey string `db:"api_key"`
+	}{
+		APIKey: apiKey,
+	}
+	err := s.stmtGetGameByAPIKey.GetContext(s.ctx, &game, query)
+	if err != nil {
+		return nil, err
+	}
+	return &game, err
+}
+
+func (s *Service) GetDeveloperGames(accountID string) ([]*lemon_api.Game, error) {
+	var games []*lemon_api.Game
+	query := struct {
+		AccountID string `db:"account_id"`
+	}{
+		AccountID: accountID,
+	}
+	err := s.stmtGetDeveloperGames.SelectContext(s.ctx, &games, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetDeveloperGames")
+		return nil, err
+	}
+	return games, err
+}
+
+func (s *Service) UpdateGameSharing(gameID string, enabled bool) error {
+	query := struct {
+		ID             string `db:"id"`
+		SharingEnabled bool   `db:"sharing_enabled"`
+	}{
+		ID:             gameID,
+		SharingEnabled: enabled,
+	}
+	_, err := s.stmtUpdateGameSharing.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec UpdateGameSharing")
+		return err
+	}
+	return nil
+}
+
+func (s *Service) AddGameDeveloper(gameID string, accountID string) error {
+	query := struct {
+		GameID    string `db:"game_id"`
+		AccountID string `db:"account_id"`
+	}{
+		GameID:    gameID,
+		AccountID: accountID,
+	}
+	_, err := s.stmtAddGameDeveloper.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec AddGameDeveloper")
+		return err
+	}
+	return nil
+}
+
+func (s *Service) RemoveGameDeveloper(gameID string, accountID string) error {
+	query := struct {
+		GameID    string `db:"game_id"`
+		AccountID string `db:"account_id"`
+	}{
+		GameID:    gameID,
+		AccountID: accountID,
+	}
+	_, err := s.stmtRemoveGameDeveloper.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec RemoveGameDeveloper")
+		return err
+	}
+	return nil
+}
+
+func (s *Service) IsGameDeveloper(gameID string, accountID string) (bool, error) {
+	var isDeveloper bool
+	query := struct {
+		GameID    string `db:"game_id"`
+		AccountID string `db:"account_id"`
+	}{
+		GameID:    gameID,
+		AccountID: accountID,
+	}
+	err := s.stmtIsGameDeveloper.GetContext(s.ctx, &isDeveloper, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Get IsGameDeveloper")
+		return false, err
+	}
+	return isDeveloper, nil
+}
@@ -0,0 +1,29 @@
+package postgres
+
+import (
+	"context"
+)
+
+// SchemaVersion is the migration the code expects the database to be at.
+// Set it to the number of every migration added to migrate/lemon; a test
+// checks the two agree.
+const SchemaVersion = 20
+
+// Ping checks the database can be reached.
+func (s *Service) Ping(ctx context.Context) error {
+	return s.conn.PingContext(ctx)
+}
+
+// GetSchemaVersion reads the migration the database is at from the table
+// migrate keeps. Dirty is set when a migration failed part way through.
+func (s *Service) GetSchemaVersion(ctx context.Context) (int64, bool, error) {
+	var migration struct {
+		Version int64 `db:"version"`
+		Dirty   bool  `db:"dirty"`
+	}
+	err := s.conn.GetContext(ctx, &migration, `SELECT version, dirty FROM schema_migrations LIMIT 1`)
+	if err != nil {
+		return 0, false, err
+	}
+	return migration.Version, migration.Dirty, nil
+}
@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSchemaVersionMatchesMigrations(t *testing.T) {
+	files, err := ioutil.ReadDir("../../migrate/lemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var latest int64
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".up.sql") {
+			continue
+		}
+		version, err := strconv.ParseInt(strings.SplitN(file.Name(), "_", 2)[0], 10, 64)
+		if err != nil {
+			t.Fatalf("migration %s doesn't start with its number", file.Name())
+		}
+		if version > latest {
+			latest = version
+		}
+	}
+
+	if latest != SchemaVersion {
+		t.Fatalf("SchemaVersion is %d but the latest migration is %d", SchemaVersion, latest)
+	}
+}
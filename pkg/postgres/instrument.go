@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"lemon/lemon-api/pkg/metrics"
+	"lemon/lemon-api/pkg/tracing"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentedDriverName is pq wrapped so every statement's duration is
+// recorded, and traced, under the name it was prepared with.
+const instrumentedDriverName = "lemon-postgres"
+
+// adhocStatement labels queries that weren't prepared by name, such as the
+// feedback listing built from a filter.
+const adhocStatement = "adhoc"
+
+func init() {
+	sql.Register(instrumentedDriverName, instrumentedDriver{pq.Driver{}})
+}
+
+// statementNames maps the text of each named statement, as the driver sees
+// it, to its name.
+var statementNames sync.Map
+
+func nameStatement(name string, query string) {
+	statementNames.Store(query, strings.TrimPrefix(name, "stmt"))
+}
+
+func statementName(query string) string {
+	if name, ok := statementNames.Load(query); ok {
+		return name.(string)
+	}
+	return adhocStatement
+}
+
+// observe starts a span for query beneath any in ctx. The returned func ends
+// it and records how long the query took.
+func observe(ctx context.Context, query string) (context.Context, func(error)) {
+	name := statementName(query)
+	started := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "postgres "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBStatementKey.String(query),
+		),
+	)
+	return ctx, func(err error) {
+		if err != nil && err != driver.ErrSkip {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		if err != driver.ErrSkip {
+			metrics.ObserveQuery(name, time.Since(started), err)
+		}
+	}
+}
+
+type instrumentedDriver struct {
+	driver driver.Driver
+}
+
+func (d instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	pqConn, ok := conn.(pqConn)
+	if !ok {
+		return conn, nil
+	}
+	return &instrumentedConn{pqConn}, nil
+}
+
+// pqConn is what pq's connections implement beyond driver.Conn.
+type pqConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.Pinger
+	driver.QueryerContext
+	driver.ExecerContext
+}
+
+type instrumentedConn struct {
+	pqConn
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.pqConn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, query: query}, nil
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, done := observe(ctx, query)
+	rows, err := c.pqConn.QueryContext(ctx, query, args)
+	done(err)
+	return rows, err
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ctx, done := observe(ctx, query)
+	result, err := c.pqConn.ExecContext(ctx, query, args)
+	done(err)
+	return result, err
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+	query string
+}
+
+// ExecContext and QueryContext are only here so the statement's span can
+// join the caller's trace; pq's statements don't take a context themselves.
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	values, err := namedValues(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	_, done := observe(ctx, s.query)
+	result, err := s.Stmt.Exec(values)
+	done(err)
+	return result, err
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	values, err := namedValues(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	_, done := observe(ctx, s.query)
+	rows, err := s.Stmt.Query(values)
+	done(err)
+	return rows, err
+}
+
+// namedValues turns arguments back into the positional values pq's statements
+// take, the way database/sql would for a driver without context support.
+func namedValues(ctx context.Context, args []driver.NamedValue) ([]driver.Value, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("postgres: named arguments are not supported")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"lemon/lemon-api/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeConn stands in for a pq connection whose statements return no rows.
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+func (fakeConn) Ping(ctx context.Context) error            { return nil }
+
+func (fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return nil, driver.ErrSkip
+}
+
+func (fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return fakeRows{}, nil
+}
+
+func (fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+type fakeStmt struct{}
+
+func (fakeStmt) Close() error                                    { return nil }
+func (fakeStmt) NumInput() int                                   { return -1 }
+func (fakeStmt) Exec(args []driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (fakeStmt) Query(args []driver.Value) (driver.Rows, error)  { return fakeRows{}, nil }
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string              { return []string{"id"} }
+func (fakeRows) Close() error                   { return nil }
+func (fakeRows) Next(dest []driver.Value) error { return io.EOF }
+
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &instrumentedConn{fakeConn{}}, nil
+}
+
+func (fakeConnector) Driver() driver.Driver { return instrumentedDriver{} }
+
+func TestQuerySpanJoinsRequest(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.Install(nil, sdktrace.WithSyncer(exporter))
+	defer provider.Shutdown(context.Background())
+
+	db := sql.OpenDB(fakeConnector{})
+	defer db.Close()
+
+	query := `SELECT id FROM games WHERE slug = $1`
+	nameStatement("stmtGetGameBySlug", query)
+	stmt, err := db.Prepare(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(tracing.Middleware())
+	engine.GET("api/games/:game", func(c *gin.Context) {
+		rows, err := stmt.QueryContext(c.Request.Context(), c.Param("game"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		rows.Close()
+	})
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/games/lemon", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want the query's and the request's", len(spans))
+	}
+	statement, request := spans[0], spans[1]
+	if request.Name != "GET /api/games/:game" || request.SpanKind != trace.SpanKindServer {
+		t.Fatalf("request span is %q of kind %v", request.Name, request.SpanKind)
+	}
+	if statement.Name != "postgres GetGameBySlug" || statement.SpanKind != trace.SpanKindClient {
+		t.Fatalf("query span is %q of kind %v", statement.Name, statement.SpanKind)
+	}
+	if statement.Parent.SpanID() != request.SpanContext.SpanID() {
+		t.Error("query span isn't a child of the request span")
+	}
+}
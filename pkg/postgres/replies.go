@@ -0,0 +1,231 @@
+package postgres
+
+import (
+	lemon_api "lemon/lemon-api"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+)
+
+func (srv *Service) prepareReplyStatements() error {
+	var err error
+
+	srv.stmtInsertFeedbackReply, err = srv.prepareNamed("stmtInsertFeedbackReply", `
+	INSERT INTO feedback_replies (
+		feedback_id,
+	    author_id,
+	    from_developer,
+	    body,
+	    created
+	    ) VALUES (
+	    :feedback_id,
+	    :author_id,
+	    :from_developer,
+	    :body,
+	    :created
+	)
+	RETURNING id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtInsertFeedbackReply")
+		return err
+	}
+
+	srv.stmtGetFeedbackReplies, err = srv.prepareNamed("stmtGetFeedbackReplies", `
+	SELECT
+		r.id,
+	    r.feedback_id,
+	    r.author_id,
+	    COALESCE(u.username, '') AS author,
+	    r.from_developer,
+	    r.body,
+	    r.player_read,
+	    r.created
+	FROM
+		feedback_replies r
+	JOIN
+		feedback f ON f.id = r.feedback_id
+	LEFT JOIN
+		usertable u ON u.id = r.author_id
+	WHERE
+		r.feedback_id = :feedback_id AND f.game_id = :game_id
+	ORDER BY
+		r.created, r.id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetFeedbackReplies")
+		return err
+	}
+
+	srv.stmtMarkFeedbackRepliesRead, err = srv.prepareNamed("stmtMarkFeedbackRepliesRead", `
+	UPDATE feedback_replies r
+	SET player_read = true
+	FROM feedback f
+	WHERE
+		f.id = r.feedback_id
+		AND r.feedback_id = :feedback_id
+		AND f.game_id = :game_id
+		AND r.from_developer
+		AND NOT r.player_read
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtMarkFeedbackRepliesRead")
+		return err
+	}
+
+	srv.stmtGetAccountFeedback, err = srv.prepareNamed("stmtGetAccountFeedback", `
+	SELECT
+		f.id,
+		f.account_id,
+		f.rating,
+	    f.description,
+	    f.type,
+	    COALESCE(f.build, '') AS build,
+	    f.metadata,
+	    f.submitted,
+	    f.read,
+	    f.status,
+	    (
+	        SELECT COUNT(*) FROM feedback_replies r
+	        WHERE r.feedback_id = f.id AND r.from_developer AND NOT r.player_read
+	    ) AS unread_replies
+	FROM
+		feedback f
+	WHERE
+		f.game_id = :game_id AND f.account_id = :account_id AND f.status <> 'quarantined'
+	ORDER BY
+		f.submitted DESC, f.id DESC
+	LIMIT :limit
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetAccountFeedback")
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) InsertFeedbackReply(reply lemon_api.FeedbackReply) (int64, error) {
+	now := time.Now().UTC()
+	reply.Created = &now
+	var returnID int64
+	err := s.stmtInsertFeedbackReply.QueryRowContext(s.ctx, reply).Scan(&returnID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to QueryRow InsertFeedbackReply")
+	}
+	return returnID, err
+}
+
+func (s *Service) GetFeedbackReplies(gameID string, feedbackID int64) ([]*lemon_api.FeedbackReply, error) {
+	var replies []*lemon_api.FeedbackReply
+	query := struct {
+		GameID     string `db:"game_id"`
+		FeedbackID int64  `db:"feedback_id"`
+	}{
+		GameID:     gameID,
+		FeedbackID: feedbackID,
+	}
+	err := s.stmtGetFeedbackReplies.SelectContext(s.ctx, &replies, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetFeedbackReplies")
+		return nil, err
+	}
+	return replies, err
+}
+
+// MarkFeedbackRepliesRead records that the submitting player has seen every
+// developer reply to their feedback.
+func (s *Service) MarkFeedbackRepliesRead(gameID string, feedbackID int64) error {
+	query := struct {
+		GameID     string `db:"game_id"`
+		FeedbackID int64  `db:"feedback_id"`
+	}{
+		GameID:     gameID,
+		FeedbackID: feedbackID,
+	}
+	_, err := s.stmtMarkFeedbackRepliesRead.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec MarkFeedbackRepliesRead")
+		return err
+	}
+	return nil
+}
+
+// GetAccountFeedback returns the most recent feedback a player submitted along
+// with the replies to each.
+func (s *Service) GetAccountFeedback(gameID string, accountID string) ([]*lemon_api.PlayerFeedback, error) {
+	var feedback []*lemon_api.PlayerFeedback
+	query := struct {
+		GameID    string `db:"game_id"`
+		AccountID string `db:"account_id"`
+		Limit     int    `db:"limit"`
+	}{
+		GameID:    gameID,
+		AccountID: accountID,
+		Limit:     maxFeedbackLimit,
+	}
+	err := s.stmtGetAccountFeedback.SelectContext(s.ctx, &feedback, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetAccountFeedback")
+		return nil, err
+	}
+	if len(feedback) == 0 {
+		return feedback, nil
+	}
+
+	ids := make([]int64, len(feedback))
+	byID := make(map[int64]*lemon_api.PlayerFeedback, len(feedback))
+	for i, f := range feedback {
+		ids[i] = f.ID
+		f.Replies = []*lemon_api.FeedbackReply{}
+		byID[f.ID] = f
+	}
+
+	repliesQuery, args, err := sqlx.In(`
+	SELECT
+		r.id,
+	    r.feedback_id,
+	    r.author_id,
+	    COALESCE(u.username, '') AS author,
+	    r.from_developer,
+	    r.body,
+	    r.player_read,
+	    r.created
+	FROM
+		feedback_replies r
+	LEFT JOIN
+		usertable u ON u.id = r.author_id
+	WHERE
+		r.feedback_id IN (?)
+	ORDER BY
+		r.created, r.id
+`, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var replies []*lemon_api.FeedbackReply
+	err = s.conn.SelectContext(s.ctx, &replies, s.conn.Rebind(repliesQuery), args...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetAccountFeedback replies")
+		return nil, err
+	}
+	for _, reply := range replies {
+		if f, ok := byID[reply.FeedbackID]; ok {
+			f.Replies = append(f.Replies, reply)
+		}
+	}
+
+	return feedback, nil
+}
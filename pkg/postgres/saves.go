@@ -0,0 +1,507 @@
+package postgres
+
+import (
+	"errors"
+	lemon_api "lemon/lemon-api"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrShareUnavailable = errors.New("share code expired, used or unknown")
+)
+
+func (srv *Service) prepareSaveStatements() error {
+	var err error
+
+	srv.stmtUpsertSaveSchema, err = srv.prepareNamed("stmtUpsertSaveSchema", `
+	INSERT INTO save_schemas (
+		game_id,
+		version,
+	    schema,
+	    created
+	    ) VALUES (
+	    :game_id,
+	    :version,
+	    :schema,
+	    :created
+	)
+	ON CONFLICT (game_id, version) DO UPDATE
+	SET schema = EXCLUDED.schema,
+	    created = EXCLUDED.created
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtUpsertSaveSchema")
+		return err
+	}
+
+	srv.stmtGetSaveSchemas, err = srv.prepareNamed("stmtGetSaveSchemas", `
+	SELECT
+		game_id,
+		version,
+	    schema,
+	    created
+	FROM
+		save_schemas
+	WHERE
+		game_id = :game_id
+	ORDER BY
+		created
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetSaveSchemas")
+		return err
+	}
+
+	srv.stmtGetSaveSchema, err = srv.prepareNamed("stmtGetSaveSchema", `
+	SELECT
+		game_id,
+		version,
+	    schema,
+	    created
+	FROM
+		save_schemas
+	WHERE
+		game_id = :game_id AND version = :version
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetSaveSchema")
+		return err
+	}
+
+	srv.stmtUpsertSaveMigration, err = srv.prepareNamed("stmtUpsertSaveMigration", `
+	INSERT INTO save_migrations (
+		game_id,
+		from_version,
+	    to_version,
+	    kind,
+	    definition,
+	    created
+	    ) VALUES (
+	    :game_id,
+	    :from_version,
+	    :to_version,
+	    :kind,
+	    :definition,
+	    :created
+	)
+	ON CONFLICT (game_id, from_version) DO UPDATE
+	SET to_version = EXCLUDED.to_version,
+	    kind = EXCLUDED.kind,
+	    definition = EXCLUDED.definition,
+	    created = EXCLUDED.created
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtUpsertSaveMigration")
+		return err
+	}
+
+	srv.stmtGetSaveMigrations, err = srv.prepareNamed("stmtGetSaveMigrations", `
+	SELECT
+		game_id,
+		from_version,
+	    to_version,
+	    kind,
+	    definition,
+	    created
+	FROM
+		save_migrations
+	WHERE
+		game_id = :game_id
+	ORDER BY
+		created
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetSaveMigrations")
+		return err
+	}
+
+	srv.stmtGetSave, err = srv.prepareNamed("stmtGetSave", `
+	SELECT
+		game_id,
+		account_id,
+	    slot,
+	    COALESCE(save_state, '') AS save_state,
+	    COALESCE(save_signature, '') AS save_signature,
+	    COALESCE(save_version, '') AS save_version,
+	    updated
+	FROM
+		saves
+	WHERE
+		game_id = :game_id AND account_id = :account_id AND slot = :slot
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetSave")
+		return err
+	}
+
+	srv.stmtGetSaves, err = srv.prepareNamed("stmtGetSaves", `
+	SELECT
+		game_id,
+		account_id,
+	    slot,
+	    COALESCE(save_state, '') AS save_state,
+	    COALESCE(save_signature, '') AS save_signature,
+	    COALESCE(save_version, '') AS save_version,
+	    updated
+	FROM
+		saves
+	WHERE
+		game_id = :game_id AND account_id = :account_id
+	ORDER BY
+		slot
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetSaves")
+		return err
+	}
+
+	srv.stmtUpsertSave, err = srv.prepareNamed("stmtUpsertSave", `
+	INSERT INTO saves (
+		game_id,
+		account_id,
+	    slot,
+	    save_state,
+	    save_signature,
+	    save_version,
+	    updated
+	    ) VALUES (
+	    :game_id,
+	    :account_id,
+	    :slot,
+	    :save_state,
+	    :save_signature,
+	    NULLIF(:save_version, ''),
+	    :updated
+	)
+	ON CONFLICT (game_id, account_id, slot) DO UPDATE
+	SET save_state = EXCLUDED.save_state,
+	    save_signature = EXCLUDED.save_signature,
+	    save_version = EXCLUDED.save_version,
+	    updated = EXCLUDED.updated
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtUpsertSave")
+		return err
+	}
+
+	srv.stmtInsertSaveShare, err = srv.prepareNamed("stmtInsertSaveShare", `
+	INSERT INTO save_shares (
+		code,
+	    game_id,
+	    account_id,
+	    slot,
+	    save_state,
+	    save_version,
+	    single_use,
+	    created,
+	    expires
+	    ) VALUES (
+	    :code,
+	    :game_id,
+	    :account_id,
+	    :slot,
+	    :save_state,
+	    NULLIF(:save_version, ''),
+	    :single_use,
+	    :created,
+	    :expires
+	)
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtInsertSaveShare")
+		return err
+	}
+
+	srv.stmtGetSaveShare, err = srv.prepareNamed("stmtGetSaveShare", `
+	SELECT
+		code,
+	    game_id,
+	    account_id,
+	    slot,
+	    COALESCE(save_state, '') AS save_state,
+	    COALESCE(save_version, '') AS save_version,
+	    single_use,
+	    redeemed,
+	    created,
+	    expires
+	FROM
+		save_shares
+	WHERE
+		code = :code
+		AND game_id = :game_id
+		AND expires > :now
+		AND (NOT single_use OR redeemed = 0)
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetSaveShare")
+		return err
+	}
+
+	srv.stmtRedeemSaveShare, err = srv.prepareNamed("stmtRedeemSaveShare", `
+	UPDATE save_shares
+	SET redeemed = redeemed + 1
+	WHERE
+		code = :code
+		AND game_id = :game_id
+		AND expires > :now
+		AND (NOT single_use OR redeemed = 0)
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtRedeemSaveShare")
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) UpsertSaveSchema(schema lemon_api.SaveSchema) error {
+	now := time.Now().UTC()
+	query := struct {
+		GameID  string     `db:"game_id"`
+		Version string     `db:"version"`
+		Schema  string     `db:"schema"`
+		Created *time.Time `db:"created"`
+	}{
+		GameID:  schema.GameID,
+		Version: schema.Version,
+		Schema:  string(schema.Schema),
+		Created: &now,
+	}
+	_, err := s.stmtUpsertSaveSchema.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec UpsertSaveSchema")
+		return err
+	}
+	return nil
+}
+
+func (s *Service) GetSaveSchemas(gameID string) ([]*lemon_api.SaveSchema, error) {
+	var schemas []*lemon_api.SaveSchema
+	query := struct {
+		GameID string `db:"game_id"`
+	}{
+		GameID: gameID,
+	}
+	err := s.stmtGetSaveSchemas.SelectContext(s.ctx, &schemas, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetSaveSchemas")
+		return nil, err
+	}
+	return schemas, err
+}
+
+func (s *Service) GetSaveSchema(gameID string, version string) (*lemon_api.SaveSchema, error) {
+	var schema lemon_api.SaveSchema
+	query := struct {
+		GameID  string `db:"game_id"`
+		Version string `db:"version"`
+	}{
+		GameID:  gameID,
+		Version: version,
+	}
+	err := s.stmtGetSaveSchema.GetContext(s.ctx, &schema, query)
+	if err != nil {
+		return nil, err
+	}
+	return &schema, err
+}
+
+func (s *Service) UpsertSaveMigration(migration lemon_api.SaveMigration) error {
+	now := time.Now().UTC()
+	query := struct {
+		GameID      string     `db:"game_id"`
+		FromVersion string     `db:"from_version"`
+		ToVersion   string     `db:"to_version"`
+		Kind        string     `db:"kind"`
+		Definition  string     `db:"definition"`
+		Created     *time.Time `db:"created"`
+	}{
+		GameID:      migration.GameID,
+		FromVersion: migration.FromVersion,
+		ToVersion:   migration.ToVersion,
+		Kind:        migration.Kind,
+		Definition:  string(migration.Definition),
+		Created:     &now,
+	}
+	_, err := s.stmtUpsertSaveMigration.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec UpsertSaveMigration")
+		return err
+	}
+	return nil
+}
+
+func (s *Service) GetSaveMigrations(gameID string) ([]*lemon_api.SaveMigration, error) {
+	var migrations []*lemon_api.SaveMigration
+	query := struct {
+		GameID string `db:"game_id"`
+	}{
+		GameID: gameID,
+	}
+	err := s.stmtGetSaveMigrations.SelectContext(s.ctx, &migrations, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetSaveMigrations")
+		return nil, err
+	}
+	return migrations, err
+}
+
+func (s *Service) GetSave(gameID string, accountID string, slot string) (*lemon_api.Save, error) {
+	var save lemon_api.Save
+	query := struct {
+		GameID    string `db:"game_id"`
+		AccountID string `db:"account_id"`
+		Slot      string `db:"slot"`
+	}{
+		GameID:    gameID,
+		AccountID: accountID,
+		Slot:      slot,
+	}
+	err := s.stmtGetSave.GetContext(s.ctx, &save, query)
+	if err != nil {
+		return nil, err
+	}
+	return &save, err
+}
+
+func (s *Service) GetSaves(gameID string, accountID string) ([]*lemon_api.Save, error) {
+	var saves []*lemon_api.Save
+	query := struct {
+		GameID    string `db:"game_id"`
+		AccountID string `db:"account_id"`
+	}{
+		GameID:    gameID,
+		AccountID: accountID,
+	}
+	err := s.stmtGetSaves.SelectContext(s.ctx, &saves, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetSaves")
+		return nil, err
+	}
+	return saves, err
+}
+
+// UpsertSave writes a save slot and queues save.updated webhooks in the same
+// transaction.
+func (s *Service) UpsertSave(save lemon_api.Save, notifiers []string) error {
+	now := time.Now().UTC()
+	save.Updated = &now
+
+	tx, err := s.conn.BeginTxx(s.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.NamedStmt(s.stmtUpsertSave).ExecContext(s.ctx, save)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec UpsertSave")
+		return err
+	}
+
+	if err := s.enqueueWebhooks(tx, save.GameID, lemon_api.WebhookEventSaveUpdated, notifiers, saveUpdatedEvent(save)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func saveUpdatedEvent(save lemon_api.Save) lemon_api.SaveUpdatedEvent {
+	return lemon_api.SaveUpdatedEvent{
+		AccountID:   save.AccountID,
+		Slot:        save.Slot,
+		SaveVersion: save.SaveVersion,
+		Updated:     save.Updated,
+	}
+}
+
+func (s *Service) InsertSaveShare(share lemon_api.SaveShare) error {
+	_, err := s.stmtInsertSaveShare.ExecContext(s.ctx, share)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec InsertSaveShare")
+		return err
+	}
+	return nil
+}
+
+// GetSaveShare returns a share code that can still be redeemed.
+func (s *Service) GetSaveShare(gameID string, code string) (*lemon_api.SaveShare, error) {
+	var share lemon_api.SaveShare
+	query := struct {
+		GameID string    `db:"game_id"`
+		Code   string    `db:"code"`
+		Now    time.Time `db:"now"`
+	}{
+		GameID: gameID,
+		Code:   code,
+		Now:    time.Now().UTC(),
+	}
+	err := s.stmtGetSaveShare.GetContext(s.ctx, &share, query)
+	if err != nil {
+		return nil, err
+	}
+	return &share, err
+}
+
+// RedeemSaveShare counts a redemption of the share code and writes the save
+// into the importing account in one transaction, so a single use code can't be
+// spent without the save landing.
+func (s *Service) RedeemSaveShare(code string, save lemon_api.Save, notifiers []string) error {
+	now := time.Now().UTC()
+	save.Updated = &now
+
+	tx, err := s.conn.BeginTxx(s.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := struct {
+		GameID string    `db:"game_id"`
+		Code   string    `db:"code"`
+		Now    time.Time `db:"now"`
+	}{
+		GameID: save.GameID,
+		Code:   code,
+		Now:    now,
+	}
+	result, err := tx.NamedStmt(s.stmtRedeemSaveShare).ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec RedeemSaveShare")
+		return err
+	}
+	if redeemed, err := result.RowsAffected(); err != nil || redeemed == 0 {
+		return ErrShareUnavailable
+	}
+
+	if _, err := tx.NamedStmt(s.stmtUpsertSave).ExecContext(s.ctx, save); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec UpsertSave for RedeemSaveShare")
+		return err
+	}
+
+	if err := s.enqueueWebhooks(tx, save.GameID, lemon_api.WebhookEventSaveUpdated, notifiers, saveUpdatedEvent(save)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
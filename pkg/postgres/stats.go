@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"errors"
+	lemon_api "lemon/lemon-api"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrInvalidBucket = errors.New("invalid bucket")
+
+const (
+	StatsBucketDay  = "day"
+	StatsBucketWeek = "week"
+)
+
+// FeedbackStats aggregates the feedback matching the filter. Series buckets
+// submissions by day or week, and builds is only filled in when byBuild is set.
+func (s *Service) FeedbackStats(filter lemon_api.FeedbackFilter, bucket string, byBuild bool) (*lemon_api.FeedbackStats, error) {
+	if bucket != StatsBucketDay && bucket != StatsBucketWeek {
+		return nil, ErrInvalidBucket
+	}
+
+	where, args := feedbackConditions(filter)
+	args["bucket"] = bucket
+
+	stats := lemon_api.FeedbackStats{
+		RatingDistribution: []*lemon_api.RatingCount{},
+		Types:              []*lemon_api.FeedbackTypeStat{},
+		Series:             []*lemon_api.FeedbackBucket{},
+	}
+
+	err := s.getStats(&stats, "totals", `
+	SELECT
+		COUNT(*) AS total,
+		COALESCE(AVG(rating), 0) AS average_rating,
+		COUNT(*) FILTER (WHERE NOT read) AS unread
+	FROM
+		feedback
+	WHERE
+		`+where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.selectStats(&stats.RatingDistribution, "ratings", `
+	SELECT
+		rating,
+		COUNT(*) AS count
+	FROM
+		feedback
+	WHERE
+		`+where+`
+	GROUP BY
+		rating
+	ORDER BY
+		rating
+`, args)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.selectStats(&stats.Types, "types", `
+	SELECT
+		COALESCE(type, '') AS type,
+		COUNT(*) AS count,
+		COUNT(*) FILTER (WHERE NOT read) AS unread
+	FROM
+		feedback
+	WHERE
+		`+where+`
+	GROUP BY
+		type
+	ORDER BY
+		count DESC, type
+`, args)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.selectStats(&stats.Series, "series", `
+	SELECT
+		date_trunc(:bucket, submitted) AS start,
+		COUNT(*) AS count,
+		COALESCE(AVG(rating), 0) AS average_rating
+	FROM
+		feedback
+	WHERE
+		`+where+`
+	GROUP BY
+		start
+	ORDER BY
+		start
+`, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if byBuild {
+		stats.Builds = []*lemon_api.FeedbackBuildStat{}
+		err = s.selectStats(&stats.Builds, "builds", `
+	SELECT
+		COALESCE(build, '') AS build,
+		COUNT(*) AS count,
+		COALESCE(AVG(rating), 0) AS average_rating,
+		COUNT(*) FILTER (WHERE NOT read) AS unread
+	FROM
+		feedback
+	WHERE
+		`+where+`
+	GROUP BY
+		build
+	ORDER BY
+		MAX(submitted) DESC
+`, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &stats, nil
+}
+
+func (s *Service) getStats(dest interface{}, name string, query string, args map[string]interface{}) error {
+	query, queryArgs, err := sqlx.Named(query, args)
+	if err != nil {
+		return err
+	}
+
+	err = s.conn.GetContext(s.ctx, dest, s.conn.Rebind(query), queryArgs...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err":   err,
+			"stats": name,
+		}).Error("Failed to Get FeedbackStats")
+	}
+	return err
+}
+
+func (s *Service) selectStats(dest interface{}, name string, query string, args map[string]interface{}) error {
+	query, queryArgs, err := sqlx.Named(query, args)
+	if err != nil {
+		return err
+	}
+
+	err = s.conn.SelectContext(s.ctx, dest, s.conn.Rebind(query), queryArgs...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err":   err,
+			"stats": name,
+		}).Error("Failed to Select FeedbackStats")
+	}
+	return err
+}
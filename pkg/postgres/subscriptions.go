@@ -0,0 +1,315 @@
+package postgres
+
+import (
+	"database/sql"
+	lemon_api "lemon/lemon-api"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const subscriptionColumns = `
+		id,
+	    game_id,
+	    url,
+	    events,
+	    secret,
+	    previous_secret,
+	    previous_secret_expires,
+	    active,
+	    created_by,
+	    created,
+	    updated`
+
+func (srv *Service) prepareSubscriptionStatements() error {
+	var err error
+
+	srv.stmtInsertSubscription, err = srv.prepareNamed("stmtInsertSubscription", `
+	INSERT INTO webhook_subscriptions (
+		game_id,
+	    url,
+	    events,
+	    secret,
+	    active,
+	    created_by,
+	    created,
+	    updated
+	    ) VALUES (
+	    :game_id,
+	    :url,
+	    :events,
+	    :secret,
+	    :active,
+	    :created_by,
+	    :created,
+	    :updated
+	) RETURNING id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtInsertSubscription")
+		return err
+	}
+
+	srv.stmtUpdateSubscription, err = srv.prepareNamed("stmtUpdateSubscription", `
+	UPDATE webhook_subscriptions
+	SET
+		url = :url,
+	    events = :events,
+	    active = :active,
+	    updated = :updated
+	WHERE
+		id = :id AND game_id = :game_id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtUpdateSubscription")
+		return err
+	}
+
+	srv.stmtDeleteSubscription, err = srv.prepareNamed("stmtDeleteSubscription", `
+	DELETE FROM webhook_subscriptions
+	WHERE
+		id = :id AND game_id = :game_id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtDeleteSubscription")
+		return err
+	}
+
+	srv.stmtGetSubscription, err = srv.prepareNamed("stmtGetSubscription", `
+	SELECT`+subscriptionColumns+`
+	FROM
+		webhook_subscriptions
+	WHERE
+		id = :id AND game_id = :game_id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetSubscription")
+		return err
+	}
+
+	srv.stmtGetSubscriptions, err = srv.prepareNamed("stmtGetSubscriptions", `
+	SELECT`+subscriptionColumns+`
+	FROM
+		webhook_subscriptions
+	WHERE
+		game_id = :game_id
+	ORDER BY
+		id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetSubscriptions")
+		return err
+	}
+
+	srv.stmtGetDeliverySubscription, err = srv.prepareNamed("stmtGetDeliverySubscription", `
+	SELECT`+subscriptionColumns+`
+	FROM
+		webhook_subscriptions
+	WHERE
+		id = :id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetDeliverySubscription")
+		return err
+	}
+
+	// The old secret keeps signing deliveries until previous_secret_expires,
+	// so receivers have time to switch over.
+	srv.stmtRotateSubscriptionSecret, err = srv.prepareNamed("stmtRotateSubscriptionSecret", `
+	UPDATE webhook_subscriptions
+	SET
+		previous_secret = secret,
+	    previous_secret_expires = :previous_secret_expires,
+	    secret = :secret,
+	    updated = :updated
+	WHERE
+		id = :id AND game_id = :game_id
+	RETURNING`+subscriptionColumns+`
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtRotateSubscriptionSecret")
+		return err
+	}
+
+	srv.stmtEnqueueSubscriptionEvents, err = srv.prepareNamed("stmtEnqueueSubscriptionEvents", `
+	INSERT INTO webhook_outbox (
+		game_id,
+	    event,
+	    sink,
+	    subscription_id,
+	    payload,
+	    next_attempt,
+	    created,
+	    traceparent
+	)
+	SELECT
+		CAST(:game_id AS VARCHAR),
+	    CAST(:event AS VARCHAR),
+	    CAST(:sink AS VARCHAR),
+	    id,
+	    CAST(:payload AS JSONB),
+	    CAST(:created AS TIMESTAMP),
+	    CAST(:created AS TIMESTAMP),
+	    CAST(:traceparent AS VARCHAR)
+	FROM
+		webhook_subscriptions
+	WHERE
+		game_id = :game_id
+		AND active
+		AND events @> jsonb_build_array(CAST(:event AS VARCHAR))
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtEnqueueSubscriptionEvents")
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) InsertWebhookSubscription(subscription lemon_api.WebhookSubscription) (int64, error) {
+	now := time.Now().UTC()
+	subscription.Created = &now
+	subscription.Updated = &now
+
+	var ID int64
+	err := s.stmtInsertSubscription.GetContext(s.ctx, &ID, subscription)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Get InsertWebhookSubscription")
+		return 0, err
+	}
+	return ID, nil
+}
+
+// UpdateWebhookSubscription changes a subscription's URL, events and whether
+// it is active. It returns sql.ErrNoRows if the game has no such subscription.
+func (s *Service) UpdateWebhookSubscription(subscription lemon_api.WebhookSubscription) error {
+	now := time.Now().UTC()
+	subscription.Updated = &now
+
+	result, err := s.stmtUpdateSubscription.ExecContext(s.ctx, subscription)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec UpdateWebhookSubscription")
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteWebhookSubscription removes a subscription along with its queued and
+// logged deliveries. It returns sql.ErrNoRows if the game has no such
+// subscription.
+func (s *Service) DeleteWebhookSubscription(gameID string, ID int64) error {
+	query := struct {
+		GameID string `db:"game_id"`
+		ID     int64  `db:"id"`
+	}{
+		GameID: gameID,
+		ID:     ID,
+	}
+	result, err := s.stmtDeleteSubscription.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec DeleteWebhookSubscription")
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Service) GetWebhookSubscription(gameID string, ID int64) (*lemon_api.WebhookSubscription, error) {
+	var subscription lemon_api.WebhookSubscription
+	query := struct {
+		GameID string `db:"game_id"`
+		ID     int64  `db:"id"`
+	}{
+		GameID: gameID,
+		ID:     ID,
+	}
+	err := s.stmtGetSubscription.GetContext(s.ctx, &subscription, query)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Error("Failed to Get GetWebhookSubscription")
+		}
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (s *Service) GetWebhookSubscriptions(gameID string) ([]*lemon_api.WebhookSubscription, error) {
+	var subscriptions []*lemon_api.WebhookSubscription
+	query := struct {
+		GameID string `db:"game_id"`
+	}{
+		GameID: gameID,
+	}
+	err := s.stmtGetSubscriptions.SelectContext(s.ctx, &subscriptions, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetWebhookSubscriptions")
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// GetDeliverySubscription loads the subscription a delivery is bound for,
+// whichever game it belongs to.
+func (s *Service) GetDeliverySubscription(ID int64) (*lemon_api.WebhookSubscription, error) {
+	var subscription lemon_api.WebhookSubscription
+	query := struct {
+		ID int64 `db:"id"`
+	}{
+		ID: ID,
+	}
+	err := s.stmtGetDeliverySubscription.GetContext(s.ctx, &subscription, query)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Error("Failed to Get GetDeliverySubscription")
+		}
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// RotateWebhookSubscriptionSecret replaces a subscription's secret, keeping
+// the old one until previousExpires. It returns sql.ErrNoRows if the game has
+// no such subscription.
+func (s *Service) RotateWebhookSubscriptionSecret(gameID string, ID int64, secret string, previousExpires time.Time) (*lemon_api.WebhookSubscription, error) {
+	var subscription lemon_api.WebhookSubscription
+	query := struct {
+		GameID                string    `db:"game_id"`
+		ID                    int64     `db:"id"`
+		Secret                string    `db:"secret"`
+		PreviousSecretExpires time.Time `db:"previous_secret_expires"`
+		Updated               time.Time `db:"updated"`
+	}{
+		GameID:                gameID,
+		ID:                    ID,
+		Secret:                secret,
+		PreviousSecretExpires: previousExpires,
+		Updated:               time.Now().UTC(),
+	}
+	err := s.stmtRotateSubscriptionSecret.GetContext(s.ctx, &subscription, query)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Error("Failed to Get RotateWebhookSubscriptionSecret")
+		}
+		return nil, err
+	}
+	return &subscription, nil
+}
@@ -0,0 +1,399 @@
+package postgres
+
+import (
+	"errors"
+	lemon_api "lemon/lemon-api"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrSurveyNotDraft = errors.New("only draft surveys can be edited")
+)
+
+func (srv *Service) prepareSurveyStatements() error {
+	var err error
+
+	srv.stmtInsertSurvey, err = srv.prepareNamed("stmtInsertSurvey", `
+	INSERT INTO surveys (
+		game_id,
+	    title,
+	    description,
+	    build,
+	    status,
+	    questions,
+	    created,
+	    updated
+	    ) VALUES (
+	    :game_id,
+	    :title,
+	    :description,
+	    NULLIF(:build, ''),
+	    :status,
+	    :questions,
+	    :created,
+	    :updated
+	)
+	RETURNING id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtInsertSurvey")
+		return err
+	}
+
+	srv.stmtUpdateSurvey, err = srv.prepareNamed("stmtUpdateSurvey", `
+	UPDATE surveys
+	SET
+		title = :title,
+	    description = :description,
+	    build = NULLIF(:build, ''),
+	    questions = :questions,
+	    updated = :updated
+	WHERE
+		id = :id AND game_id = :game_id AND status = 'draft'
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtUpdateSurvey")
+		return err
+	}
+
+	srv.stmtUpdateSurveyStatus, err = srv.prepareNamed("stmtUpdateSurveyStatus", `
+	UPDATE surveys
+	SET
+		status = :status,
+	    updated = :updated
+	WHERE
+		id = :id AND game_id = :game_id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtUpdateSurveyStatus")
+		return err
+	}
+
+	srv.stmtGetSurvey, err = srv.prepareNamed("stmtGetSurvey", `
+	SELECT
+		id,
+	    title,
+	    description,
+	    COALESCE(build, '') AS build,
+	    status,
+	    questions,
+	    created,
+	    updated
+	FROM
+		surveys
+	WHERE
+		id = :id AND game_id = :game_id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetSurvey")
+		return err
+	}
+
+	srv.stmtGetSurveys, err = srv.prepareNamed("stmtGetSurveys", `
+	SELECT
+		id,
+	    title,
+	    description,
+	    COALESCE(build, '') AS build,
+	    status,
+	    questions,
+	    created,
+	    updated
+	FROM
+		surveys
+	WHERE
+		game_id = :game_id
+	ORDER BY
+		created DESC, id DESC
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetSurveys")
+		return err
+	}
+
+	srv.stmtGetPublishedSurveys, err = srv.prepareNamed("stmtGetPublishedSurveys", `
+	SELECT
+		id,
+	    title,
+	    description,
+	    COALESCE(build, '') AS build,
+	    status,
+	    questions,
+	    created,
+	    updated
+	FROM
+		surveys
+	WHERE
+		game_id = :game_id
+		AND status = 'published'
+		AND (CAST(:build AS VARCHAR) = '' OR build IS NULL OR build = :build)
+	ORDER BY
+		created DESC, id DESC
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetPublishedSurveys")
+		return err
+	}
+
+	srv.stmtInsertSurveyResponse, err = srv.prepareNamed("stmtInsertSurveyResponse", `
+	INSERT INTO survey_responses (
+		survey_id,
+	    account_id,
+	    build,
+	    answers,
+	    submitted
+	    ) VALUES (
+	    :survey_id,
+	    :account_id,
+	    NULLIF(:build, ''),
+	    :answers,
+	    :submitted
+	)
+	RETURNING id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtInsertSurveyResponse")
+		return err
+	}
+
+	srv.stmtCountSurveyResponses, err = srv.prepareNamed("stmtCountSurveyResponses", `
+	SELECT
+		COUNT(*)
+	FROM
+		survey_responses r
+	JOIN
+		surveys s ON s.id = r.survey_id
+	WHERE
+		r.survey_id = :survey_id
+		AND s.game_id = :game_id
+		AND (CAST(:build AS VARCHAR) = '' OR r.build = :build)
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtCountSurveyResponses")
+		return err
+	}
+
+	srv.stmtGetSurveyAnswered, err = srv.prepareNamed("stmtGetSurveyAnswered", `
+	SELECT
+		a.key AS question_id,
+	    COUNT(*) AS count
+	FROM
+		survey_responses r
+	JOIN
+		surveys s ON s.id = r.survey_id
+	CROSS JOIN LATERAL
+		jsonb_each(r.answers) a
+	WHERE
+		r.survey_id = :survey_id
+		AND s.game_id = :game_id
+		AND (CAST(:build AS VARCHAR) = '' OR r.build = :build)
+		AND jsonb_typeof(a.value) <> 'null'
+	GROUP BY
+		a.key
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetSurveyAnswered")
+		return err
+	}
+
+	// Multiple choice answers are unnested so each picked option is counted.
+	srv.stmtGetSurveyAnswerCounts, err = srv.prepareNamed("stmtGetSurveyAnswerCounts", `
+	SELECT
+		a.key AS question_id,
+	    COALESCE(o.value, a.value #>> '{}') AS answer,
+	    COUNT(*) AS count
+	FROM
+		survey_responses r
+	JOIN
+		surveys s ON s.id = r.survey_id
+	CROSS JOIN LATERAL
+		jsonb_each(r.answers) a
+	LEFT JOIN LATERAL
+		jsonb_array_elements_text(CASE WHEN jsonb_typeof(a.value) = 'array' THEN a.value END) o ON true
+	WHERE
+		r.survey_id = :survey_id
+		AND s.game_id = :game_id
+		AND (CAST(:build AS VARCHAR) = '' OR r.build = :build)
+		AND jsonb_typeof(a.value) <> 'null'
+		AND (jsonb_typeof(a.value) <> 'array' OR o.value IS NOT NULL)
+	GROUP BY
+		a.key, answer
+	ORDER BY
+		a.key, count DESC
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetSurveyAnswerCounts")
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) InsertSurvey(survey lemon_api.Survey) (int64, error) {
+	now := time.Now().UTC()
+	survey.Created = &now
+	survey.Updated = &now
+	var returnID int64
+	err := s.stmtInsertSurvey.QueryRowContext(s.ctx, survey).Scan(&returnID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to QueryRow InsertSurvey")
+	}
+	return returnID, err
+}
+
+// UpdateSurvey replaces the definition of a draft survey. Once published a
+// survey is fixed so every response answers the same questions.
+func (s *Service) UpdateSurvey(survey lemon_api.Survey) error {
+	now := time.Now().UTC()
+	survey.Updated = &now
+	result, err := s.stmtUpdateSurvey.ExecContext(s.ctx, survey)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec UpdateSurvey")
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		return ErrSurveyNotDraft
+	}
+	return nil
+}
+
+func (s *Service) UpdateSurveyStatus(gameID string, ID int64, status string) error {
+	now := time.Now().UTC()
+	query := struct {
+		GameID  string     `db:"game_id"`
+		ID      int64      `db:"id"`
+		Status  string     `db:"status"`
+		Updated *time.Time `db:"updated"`
+	}{
+		GameID:  gameID,
+		ID:      ID,
+		Status:  status,
+		Updated: &now,
+	}
+	_, err := s.stmtUpdateSurveyStatus.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec UpdateSurveyStatus")
+		return err
+	}
+	return nil
+}
+
+func (s *Service) GetSurvey(gameID string, ID int64) (*lemon_api.Survey, error) {
+	var survey lemon_api.Survey
+	query := struct {
+		GameID string `db:"game_id"`
+		ID     int64  `db:"id"`
+	}{
+		GameID: gameID,
+		ID:     ID,
+	}
+	err := s.stmtGetSurvey.GetContext(s.ctx, &survey, query)
+	if err != nil {
+		return nil, err
+	}
+	return &survey, nil
+}
+
+func (s *Service) GetSurveys(gameID string) ([]*lemon_api.Survey, error) {
+	var surveys []*lemon_api.Survey
+	query := struct {
+		GameID string `db:"game_id"`
+	}{
+		GameID: gameID,
+	}
+	err := s.stmtGetSurveys.SelectContext(s.ctx, &surveys, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetSurveys")
+		return nil, err
+	}
+	return surveys, err
+}
+
+// GetPublishedSurveys returns the surveys players of a build should be shown,
+// which includes surveys published for every build.
+func (s *Service) GetPublishedSurveys(gameID string, build string) ([]*lemon_api.Survey, error) {
+	var surveys []*lemon_api.Survey
+	query := struct {
+		GameID string `db:"game_id"`
+		Build  string `db:"build"`
+	}{
+		GameID: gameID,
+		Build:  build,
+	}
+	err := s.stmtGetPublishedSurveys.SelectContext(s.ctx, &surveys, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetPublishedSurveys")
+		return nil, err
+	}
+	return surveys, err
+}
+
+func (s *Service) InsertSurveyResponse(response lemon_api.SurveyResponse) (int64, error) {
+	now := time.Now().UTC()
+	response.Submitted = &now
+	var returnID int64
+	err := s.stmtInsertSurveyResponse.QueryRowContext(s.ctx, response).Scan(&returnID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to QueryRow InsertSurveyResponse")
+	}
+	return returnID, err
+}
+
+// GetSurveyAnswerCounts aggregates the responses to a survey, optionally only
+// those from one build. It returns the number of responses, how many of them
+// answered each question and how often each answer was given.
+func (s *Service) GetSurveyAnswerCounts(gameID string, surveyID int64, build string) (int64, map[string]int64, []*lemon_api.SurveyAnswerCount, error) {
+	query := struct {
+		GameID   string `db:"game_id"`
+		SurveyID int64  `db:"survey_id"`
+		Build    string `db:"build"`
+	}{
+		GameID:   gameID,
+		SurveyID: surveyID,
+		Build:    build,
+	}
+
+	var responses int64
+	if err := s.stmtCountSurveyResponses.GetContext(s.ctx, &responses, query); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Get CountSurveyResponses")
+		return 0, nil, nil, err
+	}
+
+	var answeredRows []*lemon_api.SurveyAnswerCount
+	if err := s.stmtGetSurveyAnswered.SelectContext(s.ctx, &answeredRows, query); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetSurveyAnswered")
+		return 0, nil, nil, err
+	}
+	answered := make(map[string]int64, len(answeredRows))
+	for _, row := range answeredRows {
+		answered[row.QuestionID] = row.Count
+	}
+
+	var counts []*lemon_api.SurveyAnswerCount
+	if err := s.stmtGetSurveyAnswerCounts.SelectContext(s.ctx, &counts, query); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetSurveyAnswerCounts")
+		return 0, nil, nil, err
+	}
+
+	return responses, answered, counts, nil
+}
@@ -0,0 +1,265 @@
+package postgres
+
+import (
+	"errors"
+	lemon_api "lemon/lemon-api"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrStatusChanged = errors.New("feedback status changed concurrently")
+)
+
+func (srv *Service) prepareTriageStatements() error {
+	var err error
+
+	srv.stmtUpdateFeedbackStatus, err = srv.prepareNamed("stmtUpdateFeedbackStatus", `
+	UPDATE feedback
+	SET
+		status = :to_status,
+	    duplicate_of = :duplicate_of
+	WHERE
+		id = :id
+		AND game_id = :game_id
+		AND status = :from_status
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtUpdateFeedbackStatus")
+		return err
+	}
+
+	srv.stmtInsertFeedbackStatusChange, err = srv.prepareNamed("stmtInsertFeedbackStatusChange", `
+	INSERT INTO feedback_status_history (
+		feedback_id,
+	    from_status,
+	    to_status,
+	    changed_by,
+	    changed
+	    ) VALUES (
+	    :id,
+	    :from_status,
+	    :to_status,
+	    :changed_by,
+	    :changed
+	)
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtInsertFeedbackStatusChange")
+		return err
+	}
+
+	srv.stmtGetFeedbackHistory, err = srv.prepareNamed("stmtGetFeedbackHistory", `
+	SELECT
+		h.id,
+	    h.feedback_id,
+	    h.from_status,
+	    h.to_status,
+	    h.changed_by,
+	    h.changed
+	FROM
+		feedback_status_history h
+	JOIN
+		feedback f ON f.id = h.feedback_id
+	WHERE
+		h.feedback_id = :feedback_id AND f.game_id = :game_id
+	ORDER BY
+		h.changed, h.id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetFeedbackHistory")
+		return err
+	}
+
+	srv.stmtAssignFeedback, err = srv.prepareNamed("stmtAssignFeedback", `
+	UPDATE feedback
+	SET assignee_id = :assignee_id
+	WHERE id = :id AND game_id = :game_id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtAssignFeedback")
+		return err
+	}
+
+	srv.stmtInsertFeedbackNote, err = srv.prepareNamed("stmtInsertFeedbackNote", `
+	INSERT INTO feedback_notes (
+		feedback_id,
+	    author_id,
+	    body,
+	    created
+	    ) VALUES (
+	    :feedback_id,
+	    :author_id,
+	    :body,
+	    :created
+	)
+	RETURNING id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtInsertFeedbackNote")
+		return err
+	}
+
+	srv.stmtGetFeedbackNotes, err = srv.prepareNamed("stmtGetFeedbackNotes", `
+	SELECT
+		n.id,
+	    n.feedback_id,
+	    n.author_id,
+	    COALESCE(u.username, '') AS author,
+	    n.body,
+	    n.created
+	FROM
+		feedback_notes n
+	JOIN
+		feedback f ON f.id = n.feedback_id
+	LEFT JOIN
+		usertable u ON u.id = n.author_id
+	WHERE
+		n.feedback_id = :feedback_id AND f.game_id = :game_id
+	ORDER BY
+		n.created, n.id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetFeedbackNotes")
+		return err
+	}
+
+	return nil
+}
+
+// UpdateFeedbackStatus moves feedback from one status to another and records
+// the change in its history, queueing feedback.status_changed webhooks in the
+// same transaction. It returns ErrStatusChanged if the feedback is no longer
+// in the status the caller validated the transition against.
+func (s *Service) UpdateFeedbackStatus(gameID string, ID int64, from string, to string, duplicateOf *int64, changedBy string, notifiers []string) error {
+	now := time.Now().UTC()
+	query := struct {
+		GameID      string     `db:"game_id"`
+		ID          int64      `db:"id"`
+		FromStatus  string     `db:"from_status"`
+		ToStatus    string     `db:"to_status"`
+		DuplicateOf *int64     `db:"duplicate_of"`
+		ChangedBy   string     `db:"changed_by"`
+		Changed     *time.Time `db:"changed"`
+	}{
+		GameID:      gameID,
+		ID:          ID,
+		FromStatus:  from,
+		ToStatus:    to,
+		DuplicateOf: duplicateOf,
+		ChangedBy:   changedBy,
+		Changed:     &now,
+	}
+
+	tx, err := s.conn.BeginTxx(s.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.NamedStmt(s.stmtUpdateFeedbackStatus).ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec UpdateFeedbackStatus")
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		return ErrStatusChanged
+	}
+
+	if _, err := tx.NamedStmt(s.stmtInsertFeedbackStatusChange).ExecContext(s.ctx, query); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec InsertFeedbackStatusChange")
+		return err
+	}
+
+	event := lemon_api.FeedbackStatusChangedEvent{
+		FeedbackID:  ID,
+		FromStatus:  from,
+		ToStatus:    to,
+		DuplicateOf: duplicateOf,
+		ChangedBy:   changedBy,
+		Changed:     &now,
+	}
+	if err := s.enqueueWebhooks(tx, gameID, lemon_api.WebhookEventFeedbackStatusChanged, notifiers, event); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Service) GetFeedbackHistory(gameID string, feedbackID int64) ([]*lemon_api.FeedbackStatusChange, error) {
+	var history []*lemon_api.FeedbackStatusChange
+	query := struct {
+		GameID     string `db:"game_id"`
+		FeedbackID int64  `db:"feedback_id"`
+	}{
+		GameID:     gameID,
+		FeedbackID: feedbackID,
+	}
+	err := s.stmtGetFeedbackHistory.SelectContext(s.ctx, &history, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetFeedbackHistory")
+		return nil, err
+	}
+	return history, err
+}
+
+// AssignFeedback sets the developer responsible for feedback. A nil assignee
+// unassigns it.
+func (s *Service) AssignFeedback(gameID string, ID int64, assigneeID *string) error {
+	query := struct {
+		GameID     string  `db:"game_id"`
+		ID         int64   `db:"id"`
+		AssigneeID *string `db:"assignee_id"`
+	}{
+		GameID:     gameID,
+		ID:         ID,
+		AssigneeID: assigneeID,
+	}
+	_, err := s.stmtAssignFeedback.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec AssignFeedback")
+		return err
+	}
+	return nil
+}
+
+func (s *Service) InsertFeedbackNote(note lemon_api.FeedbackNote) (int64, error) {
+	now := time.Now().UTC()
+	note.Created = &now
+	var returnID int64
+	err := s.stmtInsertFeedbackNote.QueryRowContext(s.ctx, note).Scan(&returnID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to QueryRow InsertFeedbackNote")
+	}
+	return returnID, err
+}
+
+func (s *Service) GetFeedbackNotes(gameID string, feedbackID int64) ([]*lemon_api.FeedbackNote, error) {
+	var notes []*lemon_api.FeedbackNote
+	query := struct {
+		GameID     string `db:"game_id"`
+		FeedbackID int64  `db:"feedback_id"`
+	}{
+		GameID:     gameID,
+		FeedbackID: feedbackID,
+	}
+	err := s.stmtGetFeedbackNotes.SelectContext(s.ctx, &notes, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetFeedbackNotes")
+		return nil, err
+	}
+	return notes, err
+}
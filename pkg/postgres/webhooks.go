@@ -0,0 +1,444 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/tracing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+)
+
+const webhookColumns = `
+		id,
+	    game_id,
+	    event,
+	    sink,
+	    subscription_id,
+	    payload,
+	    status,
+	    attempts,
+	    next_attempt,
+	    last_status,
+	    last_error,
+	    created,
+	    delivered,
+	    traceparent`
+
+func (srv *Service) prepareWebhookStatements() error {
+	var err error
+
+	srv.stmtInsertWebhook, err = srv.prepareNamed("stmtInsertWebhook", `
+	INSERT INTO webhook_outbox (
+		game_id,
+	    event,
+	    sink,
+	    payload,
+	    next_attempt,
+	    created,
+	    traceparent
+	    ) VALUES (
+	    :game_id,
+	    :event,
+	    :sink,
+	    :payload,
+	    :created,
+	    :created,
+	    :traceparent
+	)
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtInsertWebhook")
+		return err
+	}
+
+	// Claimed deliveries are leased by pushing next_attempt forward, so a
+	// dispatcher that dies mid delivery only delays it. SKIP LOCKED lets
+	// several API instances dispatch from the same outbox.
+	srv.stmtClaimWebhooks, err = srv.prepareNamed("stmtClaimWebhooks", `
+	UPDATE webhook_outbox
+	SET next_attempt = :lease_until
+	WHERE id IN (
+		SELECT id
+		FROM webhook_outbox
+		WHERE status = 'pending' AND next_attempt <= :now
+		ORDER BY next_attempt
+		LIMIT :limit
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING`+webhookColumns+`,
+		(SELECT name FROM games WHERE games.id = webhook_outbox.game_id) AS game_name,
+		(SELECT slug FROM games WHERE games.id = webhook_outbox.game_id) AS game_slug
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtClaimWebhooks")
+		return err
+	}
+
+	// Every attempt is also written to webhook_attempts, which is the
+	// delivery's log.
+	srv.stmtCompleteWebhook, err = srv.prepareNamed("stmtCompleteWebhook", `
+	WITH attempt AS (
+		INSERT INTO webhook_attempts (
+			delivery_id,
+		    attempted,
+		    status,
+		    duration_ms
+		    ) VALUES (
+		    :id,
+		    :delivered,
+		    :last_status,
+		    :duration_ms
+		)
+	)
+	UPDATE webhook_outbox
+	SET
+		status = 'delivered',
+	    attempts = attempts + 1,
+	    last_status = :last_status,
+	    last_error = NULL,
+	    delivered = :delivered
+	WHERE id = :id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtCompleteWebhook")
+		return err
+	}
+
+	srv.stmtFailWebhook, err = srv.prepareNamed("stmtFailWebhook", `
+	WITH attempt AS (
+		INSERT INTO webhook_attempts (
+			delivery_id,
+		    attempted,
+		    status,
+		    error,
+		    duration_ms
+		    ) VALUES (
+		    :id,
+		    :attempted,
+		    :last_status,
+		    :last_error,
+		    :duration_ms
+		)
+	)
+	UPDATE webhook_outbox
+	SET
+		status = :status,
+	    attempts = attempts + 1,
+	    next_attempt = :next_attempt,
+	    last_status = :last_status,
+	    last_error = :last_error
+	WHERE id = :id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtFailWebhook")
+		return err
+	}
+
+	srv.stmtGetWebhookDeliveries, err = srv.prepareNamed("stmtGetWebhookDeliveries", `
+	SELECT`+webhookColumns+`
+	FROM
+		webhook_outbox
+	WHERE
+		game_id = :game_id
+		AND (CAST(:status AS VARCHAR) = '' OR status = :status)
+		AND (CAST(:subscription_id AS BIGINT) IS NULL OR subscription_id = :subscription_id)
+	ORDER BY
+		created DESC, id DESC
+	LIMIT :limit
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetWebhookDeliveries")
+		return err
+	}
+
+	srv.stmtReplayWebhook, err = srv.prepareNamed("stmtReplayWebhook", `
+	UPDATE webhook_outbox
+	SET
+		status = 'pending',
+	    attempts = 0,
+	    next_attempt = :now
+	WHERE
+		id = :id AND game_id = :game_id AND status <> 'pending'
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtReplayWebhook")
+		return err
+	}
+
+	srv.stmtGetWebhookAttempts, err = srv.prepareNamed("stmtGetWebhookAttempts", `
+	SELECT
+		a.id,
+	    a.delivery_id,
+	    a.attempted,
+	    a.status,
+	    a.error,
+	    a.duration_ms
+	FROM
+		webhook_attempts a
+	    JOIN webhook_outbox o ON o.id = a.delivery_id
+	WHERE
+		a.delivery_id = :delivery_id AND o.game_id = :game_id
+	ORDER BY
+		a.attempted, a.id
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetWebhookAttempts")
+		return err
+	}
+
+	srv.stmtGetWebhookBacklog, err = srv.prepareNamed("stmtGetWebhookBacklog", `
+	SELECT
+		COUNT(*) AS pending,
+	    COUNT(*) FILTER (WHERE next_attempt <= :now) AS due,
+	    MIN(next_attempt) FILTER (WHERE next_attempt <= :now) AS oldest_due
+	FROM
+		webhook_outbox
+	WHERE
+		status = 'pending'
+`)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed stmtGetWebhookBacklog")
+		return err
+	}
+
+	return nil
+}
+
+// enqueueWebhooks adds an event to the outbox as part of tx, once per notifier
+// and once for each of the game's subscriptions that wants it.
+func (s *Service) enqueueWebhooks(tx *sqlx.Tx, gameID string, event string, notifiers []string, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.NamedStmt(s.stmtEnqueueSubscriptionEvents).ExecContext(s.ctx, lemon_api.WebhookDelivery{
+		GameID:      gameID,
+		Event:       event,
+		Sink:        lemon_api.WebhookSinkSubscription,
+		Payload:     b,
+		Created:     &now,
+		Traceparent: s.traceparent(),
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err":   err,
+			"event": event,
+		}).Error("Failed to Exec EnqueueSubscriptionEvents")
+		return err
+	}
+
+	return s.enqueueNotifiers(tx, gameID, event, notifiers, b, now)
+}
+
+// enqueueNotifiers adds an already encoded event to the outbox as part of tx,
+// once per notifier.
+func (s *Service) enqueueNotifiers(tx *sqlx.Tx, gameID string, event string, notifiers []string, b []byte, now time.Time) error {
+	stmt := tx.NamedStmt(s.stmtInsertWebhook)
+	traceparent := s.traceparent()
+	for _, notifier := range notifiers {
+		_, err := stmt.ExecContext(s.ctx, lemon_api.WebhookDelivery{
+			GameID:      gameID,
+			Event:       event,
+			Sink:        notifier,
+			Payload:     b,
+			Created:     &now,
+			Traceparent: traceparent,
+		})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err":   err,
+				"event": event,
+				"sink":  notifier,
+			}).Error("Failed to Exec InsertWebhook")
+			return err
+		}
+	}
+	return nil
+}
+
+// traceparent is the trace context of the request the service is working
+// for, stored with the deliveries it queues. It is nil outside a trace.
+func (s *Service) traceparent() *string {
+	traceparent := tracing.Traceparent(s.ctx)
+	if traceparent == "" {
+		return nil
+	}
+	return &traceparent
+}
+
+// ClaimWebhookDeliveries leases up to limit due deliveries to the caller until
+// leaseUntil.
+func (s *Service) ClaimWebhookDeliveries(limit int, leaseUntil time.Time) ([]*lemon_api.WebhookDelivery, error) {
+	var deliveries []*lemon_api.WebhookDelivery
+	query := struct {
+		Now        time.Time `db:"now"`
+		LeaseUntil time.Time `db:"lease_until"`
+		Limit      int       `db:"limit"`
+	}{
+		Now:        time.Now().UTC(),
+		LeaseUntil: leaseUntil,
+		Limit:      limit,
+	}
+	err := s.stmtClaimWebhooks.SelectContext(s.ctx, &deliveries, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select ClaimWebhookDeliveries")
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// CompleteWebhookDelivery marks a delivery sent and logs the attempt, which
+// took duration.
+func (s *Service) CompleteWebhookDelivery(ID int64, lastStatus int, duration time.Duration) error {
+	now := time.Now().UTC()
+	query := struct {
+		ID         int64     `db:"id"`
+		LastStatus int       `db:"last_status"`
+		Delivered  time.Time `db:"delivered"`
+		DurationMS int64     `db:"duration_ms"`
+	}{
+		ID:         ID,
+		LastStatus: lastStatus,
+		Delivered:  now,
+		DurationMS: int64(duration / time.Millisecond),
+	}
+	_, err := s.stmtCompleteWebhook.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec CompleteWebhookDelivery")
+		return err
+	}
+	return nil
+}
+
+// FailWebhookDelivery records and logs a failed attempt. The delivery is
+// retried at nextAttempt, or dead lettered if dead is set.
+func (s *Service) FailWebhookDelivery(ID int64, nextAttempt time.Time, dead bool, lastStatus *int, lastError string, duration time.Duration) error {
+	status := lemon_api.WebhookStatusPending
+	if dead {
+		status = lemon_api.WebhookStatusDead
+	}
+	query := struct {
+		ID          int64     `db:"id"`
+		Status      string    `db:"status"`
+		Attempted   time.Time `db:"attempted"`
+		NextAttempt time.Time `db:"next_attempt"`
+		LastStatus  *int      `db:"last_status"`
+		LastError   string    `db:"last_error"`
+		DurationMS  int64     `db:"duration_ms"`
+	}{
+		ID:          ID,
+		Status:      status,
+		Attempted:   time.Now().UTC(),
+		NextAttempt: nextAttempt,
+		LastStatus:  lastStatus,
+		LastError:   lastError,
+		DurationMS:  int64(duration / time.Millisecond),
+	}
+	_, err := s.stmtFailWebhook.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec FailWebhookDelivery")
+		return err
+	}
+	return nil
+}
+
+// GetWebhookDeliveries lists a game's most recent deliveries, optionally only
+// those in one status or to one subscription.
+func (s *Service) GetWebhookDeliveries(gameID string, subscriptionID *int64, status string, limit int) ([]*lemon_api.WebhookDelivery, error) {
+	var deliveries []*lemon_api.WebhookDelivery
+	query := struct {
+		GameID         string `db:"game_id"`
+		SubscriptionID *int64 `db:"subscription_id"`
+		Status         string `db:"status"`
+		Limit          int    `db:"limit"`
+	}{
+		GameID:         gameID,
+		SubscriptionID: subscriptionID,
+		Status:         status,
+		Limit:          limit,
+	}
+	err := s.stmtGetWebhookDeliveries.SelectContext(s.ctx, &deliveries, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetWebhookDeliveries")
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ReplayWebhookDelivery queues a delivered or dead lettered delivery to be
+// sent again straight away. It reports false if there was nothing to replay.
+func (s *Service) ReplayWebhookDelivery(gameID string, ID int64) (bool, error) {
+	query := struct {
+		GameID string    `db:"game_id"`
+		ID     int64     `db:"id"`
+		Now    time.Time `db:"now"`
+	}{
+		GameID: gameID,
+		ID:     ID,
+		Now:    time.Now().UTC(),
+	}
+	result, err := s.stmtReplayWebhook.ExecContext(s.ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Exec ReplayWebhookDelivery")
+		return false, err
+	}
+	replayed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return replayed > 0, nil
+}
+
+// GetWebhookAttempts is the log of every attempt at sending a delivery.
+func (s *Service) GetWebhookAttempts(gameID string, deliveryID int64) ([]*lemon_api.WebhookAttempt, error) {
+	var attempts []*lemon_api.WebhookAttempt
+	query := struct {
+		GameID     string `db:"game_id"`
+		DeliveryID int64  `db:"delivery_id"`
+	}{
+		GameID:     gameID,
+		DeliveryID: deliveryID,
+	}
+	err := s.stmtGetWebhookAttempts.SelectContext(s.ctx, &attempts, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Select GetWebhookAttempts")
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// GetWebhookBacklog counts the deliveries waiting in the outbox, across every
+// game.
+func (s *Service) GetWebhookBacklog(ctx context.Context) (*lemon_api.WebhookBacklog, error) {
+	var backlog lemon_api.WebhookBacklog
+	query := struct {
+		Now time.Time `db:"now"`
+	}{
+		Now: time.Now().UTC(),
+	}
+	err := s.stmtGetWebhookBacklog.GetContext(ctx, &backlog, query)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to Get GetWebhookBacklog")
+		return nil, err
+	}
+	return &backlog, nil
+}
@@ -2,9 +2,9 @@ package rest
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	lemon_api "lemon/lemon-api"
 	"lemon/lemon-api/pkg/security"
@@ -12,15 +12,23 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 
 	"lemon/lemon-api/pkg/config"
+	"lemon/lemon-api/pkg/metrics"
+	"lemon/lemon-api/pkg/notify"
 	"lemon/lemon-api/pkg/postgres"
+	"lemon/lemon-api/pkg/spam"
+	"lemon/lemon-api/pkg/storage"
+	"lemon/lemon-api/pkg/tracing"
+	"lemon/lemon-api/pkg/webhook"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -28,40 +36,118 @@ type Server struct {
 	config   *config.Config
 	engine   *gin.Engine
 	database *postgres.Service
+	storage  storage.Store
+	spam     *spam.Checker
+
+	notifiers  map[string]notify.Notifier
+	dispatcher *webhook.Dispatcher
+	digests    *webhook.Scheduler
+
+	httpServer *http.Server
+	tracing    *tracing.Provider
+
+	// ready is set once the database is up; until then requireDatabase
+	// turns requests away. connecting is closed when a connection retried
+	// in the background, in degraded mode, gives up or succeeds.
+	ready          int32
+	stopConnecting context.CancelFunc
+	connecting     chan struct{}
 }
 
 func NewServer(cfg *config.Config, e *gin.Engine) *Server {
 	rand.Seed(time.Now().UTC().UnixNano())
 
 	return &Server{
-		config: cfg,
-		engine: e,
+		config:     cfg,
+		engine:     e,
+		httpServer: newHTTPServer(cfg.API, e),
 	}
 }
 
-func (s *Server) Initialise() {
+// Initialise registers the routes and starts the services behind them. The
+// database is retried until its startup timeout; if it never comes up the
+// error is returned, unless degraded mode is on, in which case the API answers
+// 503 while it keeps trying in the background.
+func (s *Server) Initialise() error {
+	s.engine.Use(tracing.Middleware(), metrics.Middleware())
 
-	s.engine.POST("api/feedback", s.InsertFeedback)
-	s.engine.GET("api/feedback", s.GetFeedback)
-	s.engine.GET("api/feedback/:ID", s.GetFeedbackByID)
-	s.engine.PUT("api/feedback/:ID", s.MarkReadFeedback)
+	// Health checks and metrics are registered ahead of requireDatabase so
+	// they answer while the database is down.
+	s.engine.GET("healthz", s.GetHealth)
+	s.engine.GET("readyz", s.GetReadiness)
+	s.engine.GET("metrics", gin.WrapH(metrics.Handler()))
 
-	s.engine.POST("api/register", s.NewUser)
-	s.engine.GET("api/taken/:Username", s.UserAvailableCheck)
-	s.engine.POST("api/login", s.Login)
-	s.engine.GET("api/logout", s.Logout)
-	s.engine.PUT("api/save", s.UpdateUser)
-	s.engine.PUT("api/elevate", s.ElevateUser)
-	s.engine.GET("api/save/:ID", s.GetUser)
-	s.engine.DELETE("api/save", s.DeleteUser)
+	s.engine.Use(s.requireDatabase)
 
-	if service, err := postgres.NewService(s.config); err != nil {
+	s.engine.POST("api/games", s.NewGame)
+	s.engine.GET("api/games", s.GetGames)
+
+	// Every game scoped route is served twice: under api/ for clients that
+	// identify their game with an API key header, and under api/games/:game/
+	// for clients that name it in the path.
+	s.registerGameRoutes(s.engine.Group("api"), s.gameFromKey)
+	s.registerGameRoutes(s.engine.Group("api/games/:game"), s.gameFromPath)
+
+	if store, err := storage.New(s.config.Storage); err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
-		}).Error("unable to start database service")
-		return
+		}).Error("unable to start attachment storage")
+		return errors.Wrap(err, "attachment storage")
+	} else {
+		s.storage = store
+	}
+
+	if checker, err := spam.NewChecker(s.config.Spam); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("unable to load spam rules")
+		return errors.Wrap(err, "spam rules")
+	} else {
+		s.spam = checker
+	}
+
+	if notifiers, err := notify.New(s.config.Webhooks); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("unable to load notifiers")
+		return errors.Wrap(err, "notifiers")
+	} else {
+		s.notifiers = notifiers
+	}
+
+	if provider, err := tracing.New(s.config.Tracing); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("unable to start tracing")
+		return errors.Wrap(err, "tracing")
 	} else {
-		s.database = service
+		s.tracing = provider
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopConnecting = cancel
+
+	service, err := connectDatabase(ctx, s.config, databaseStartupTimeout(s.config))
+	if err != nil {
+		if err == config.ErrInvalidConfig || s.config.API == nil || !s.config.API.DegradedMode {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Error("unable to start database service")
+			return errors.Wrap(err, "database")
+		}
+
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("database unavailable, serving 503 until it can be reached")
+		s.connecting = make(chan struct{})
+		go func() {
+			defer close(s.connecting)
+			if service, err := connectDatabase(ctx, s.config, 0); err == nil {
+				s.useDatabase(service)
+			}
+		}()
+	} else {
+		s.useDatabase(service)
 	}
 
 	var filename = "logfile.log"
@@ -73,89 +159,261 @@ func (s *Server) Initialise() {
 		log.SetOutput(f)
 	}
 
+	return nil
+}
+
+// useDatabase starts the webhook workers on the database and lets requests
+// through to it.
+func (s *Server) useDatabase(service *postgres.Service) {
+	s.database = service
+
+	s.dispatcher = webhook.NewDispatcher(s.database, s.notifiers, s.config.Webhooks)
+	s.dispatcher.Start()
+
+	s.digests = webhook.NewScheduler(s.database, notify.Digests(s.config.Webhooks))
+	s.digests.Start()
+
+	atomic.StoreInt32(&s.ready, 1)
+}
+
+// registerGameRoutes registers the game scoped routes on r behind resolve,
+// which sets the active game. Every handler that calls activeGame must be
+// registered here.
+func (s *Server) registerGameRoutes(r *gin.RouterGroup, resolve gin.HandlerFunc) {
+	r.Use(resolve)
+
+	r.POST("feedback", s.InsertFeedback)
+	r.GET("feedback", s.GetFeedback)
+	r.GET("feedback/search", s.SearchFeedback)
+	r.GET("feedback/stats", s.GetFeedbackStats)
+	r.GET("feedback/export", s.ExportFeedback)
+	r.GET("feedback/:ID", s.GetFeedbackByID)
+	r.PUT("feedback/:ID", s.MarkReadFeedback)
+	r.PUT("feedback/:ID/status", s.UpdateFeedbackStatus)
+	r.PUT("feedback/:ID/assignee", s.AssignFeedback)
+	r.GET("feedback/:ID/history", s.GetFeedbackHistory)
+	r.GET("feedback/:ID/notes", s.GetFeedbackNotes)
+	r.POST("feedback/:ID/notes", s.AddFeedbackNote)
+	r.GET("feedback/:ID/attachments", s.GetFeedbackAttachments)
+	r.GET("feedback/:ID/replies", s.GetFeedbackReplies)
+	r.POST("feedback/:ID/replies", s.AddFeedbackReply)
+	r.GET("me/feedback", s.GetMyFeedback)
+	r.GET("feedback/:ID/attachments/:attachmentID", s.DownloadFeedbackAttachment)
+
+	r.POST("register", s.NewUser)
+	r.GET("taken/:Username", s.UserAvailableCheck)
+	r.POST("login", s.Login)
+	r.GET("logout", s.Logout)
+	r.PUT("save", s.UpdateUser)
+	r.PUT("elevate", s.ElevateUser)
+	r.GET("save/:ID", s.GetUser)
+	r.DELETE("save", s.DeleteUser)
+	r.GET("reports/save-verification", s.GetSaveVerificationReport)
+
+	r.POST("schemas", s.UpsertSaveSchema)
+	r.GET("schemas", s.GetSaveSchemas)
+	r.POST("migrations", s.UpsertSaveMigration)
+	r.GET("migrations", s.GetSaveMigrations)
+
+	r.GET("saves", s.GetSaves)
+	r.GET("saves/:slot", s.GetSave)
+	r.PUT("saves/:slot", s.UpdateSave)
+	r.POST("saves/:slot/share", s.ShareSave)
+	r.POST("saves/import/:code", s.ImportSave)
+	r.GET("settings/save-sharing", s.GetSharingSettings)
+	r.PUT("settings/save-sharing", s.UpdateSharingSettings)
+
+	r.GET("surveys", s.GetSurveys)
+	r.POST("surveys", s.NewSurvey)
+	r.GET("surveys/:surveyID", s.GetSurvey)
+	r.PUT("surveys/:surveyID", s.UpdateSurvey)
+	r.PUT("surveys/:surveyID/status", s.UpdateSurveyStatus)
+	r.POST("surveys/:surveyID/responses", s.SubmitSurveyResponse)
+	r.GET("surveys/:surveyID/results", s.GetSurveyResults)
+
+	r.GET("webhooks/deliveries", s.GetWebhookDeliveries)
+	r.POST("webhooks/deliveries/:deliveryID/replay", s.ReplayWebhookDelivery)
+	r.POST("webhooks/templates/preview", s.PreviewWebhookTemplate)
+	r.GET("webhooks/deliveries/:deliveryID/attempts", s.GetWebhookAttempts)
+	r.GET("webhooks/subscriptions", s.GetWebhookSubscriptions)
+	r.POST("webhooks/subscriptions", s.NewWebhookSubscription)
+	r.GET("webhooks/subscriptions/:subscriptionID", s.GetWebhookSubscription)
+	r.PUT("webhooks/subscriptions/:subscriptionID", s.UpdateWebhookSubscription)
+	r.DELETE("webhooks/subscriptions/:subscriptionID", s.DeleteWebhookSubscription)
+	r.POST("webhooks/subscriptions/:subscriptionID/rotate", s.RotateWebhookSecret)
+	r.GET("webhooks/subscriptions/:subscriptionID/deliveries", s.GetSubscriptionDeliveries)
+
+	r.POST("developers", s.AddGameDeveloper)
+	r.DELETE("developers/:accountID", s.RemoveGameDeveloper)
+
+	r.POST("device/code", s.NewDeviceCode)
+	r.POST("device/approve", s.ApproveDeviceCode)
+	r.POST("device/deny", s.DenyDeviceCode)
+	r.POST("device/token", s.DeviceToken)
 }
 
+// InsertFeedback accepts feedback as JSON, or as a multipart form when it
+// comes with screenshots or log files attached. Feedback sent with a token is
+// linked to the player's account so they can follow replies to it.
 func (s *Server) InsertFeedback(c *gin.Context) {
 	var feedback lemon_api.Feedback
-	if err := c.BindJSON(&feedback); err != nil {
+	var attachments []*pendingAttachment
+	if isMultipart(c) {
+		var ok bool
+		if attachments, ok = s.bindFeedbackForm(c, &feedback); !ok {
+			return
+		}
+	} else if err := c.BindJSON(&feedback); err != nil {
 		log.WithFields(log.Fields{
 			"err":  err,
 			"data": feedback,
 		}).Error("Failed to bind JSON")
 		c.AbortWithStatus(http.StatusBadRequest)
+		return
 	}
-	returnedID, err := s.database.InsertFeedback(feedback)
+	if err := validateFeedbackMetadata(feedback.Metadata); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	accountID, ok := s.optionalAccount(c)
+	if !ok {
+		return
+	}
+	feedback.AccountID = accountID
+	feedback.GameID = activeGame(c).ID
+	if err := s.screenFeedback(c, &feedback); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	// Uploads are stored first so the feedback, its attachments and its
+	// webhooks are saved together or not at all.
+	stored, ok := s.storeAttachments(c, feedback.GameID, attachments)
+	if !ok {
+		return
+	}
+	_, err := s.db(c).InsertFeedback(feedback, stored, notify.For(s.notifiers, lemon_api.WebhookEventFeedbackCreated))
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
 		}).Error("Failed to insert feedback")
+		s.deleteAttachments(stored)
 		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if feedback.QuarantineReason != nil {
+		metrics.FeedbackSubmissions.WithLabelValues(metrics.OutcomeQuarantined).Inc()
+	} else {
+		metrics.FeedbackSubmissions.WithLabelValues(metrics.OutcomeAccepted).Inc()
 	}
 
-	webhookBody, err := json.Marshal(map[string]string{
-		"username":   "Feedback Piggy",
-		"avatar_url": "https://www.discordavatars.com/wp-content/uploads/2020/07/disney-character-avatar-074.jpg",
-		"content": "New feedback given! Rating: " + strconv.FormatInt(feedback.Rating, 10) + "\n " +
-			"Type: " + feedback.Type + "\n" +
-			"https://lemon.indiedev.io/feedback/" + strconv.FormatInt(returnedID, 10) + " to read full feedback.",
-	})
+	// Quarantined feedback gets the same response so spammers can't tell.
+	c.AbortWithStatus(http.StatusOK)
+}
+
+// GetFeedback lists feedback for the active game a page at a time. The total
+// number of matching rows is returned in X-Total-Count and the cursor for the
+// next page, if there is one, in X-Next-Cursor.
+func (s *Server) GetFeedback(c *gin.Context) {
+	filter, err := feedbackFilterFromQuery(c)
 	if err != nil {
-		log.Error(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	hook, err := http.Post(s.config.Webhooks.FeedbackURL, "application/json", bytes.NewBuffer(webhookBody))
+	developer, err := s.callerIsDeveloper(c)
 	if err != nil {
-		log.Error(err, hook)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	// Sessions and context are per player, so only developers may filter by
+	// them; counts alone would give them away.
+	if !developer && (filter.SessionID != "" || len(filter.Context) > 0) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "only developers may filter by session_id or context"})
+		return
+	}
+	// Triage status is only shown to developers, and filtering by it would
+	// give it away just as well. That includes quarantine, so spammers can't
+	// tell which rule caught them.
+	if !developer && filter.Status != "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "only developers may filter by status"})
+		return
 	}
 
-	c.AbortWithStatus(http.StatusOK)
-}
-
-func (s *Server) GetFeedback(c *gin.Context) {
-	data, err := s.database.GetFeedback()
+	data, next, err := s.db(c).ListFeedback(filter)
 	if err != nil {
+		if err == postgres.ErrInvalidCursor || err == postgres.ErrInvalidSort {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		log.WithFields(log.Fields{
 			"err": err,
 		}).Error("Failed to get feedback from database")
 		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	total, err := s.db(c).CountFeedback(filter)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to count feedback in database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	if next != "" {
+		c.Header("X-Next-Cursor", next)
+	}
+	if data == nil {
+		data = []*lemon_api.Feedback{}
+	}
+
+	if !developer {
+		public := make([]*lemon_api.PublicFeedback, len(data))
+		for i, feedback := range data {
+			public[i] = feedback.Public()
+		}
+		c.JSON(http.StatusOK, public)
+		return
 	}
 	c.JSON(http.StatusOK, data)
 }
 
 func (s *Server) GetFeedbackByID(c *gin.Context) {
-	ID := c.Param("ID")
-	if ID == "" {
-		c.AbortWithStatus(http.StatusBadRequest)
-	}
-
-	newID, err := strconv.ParseInt(ID, 10, 32)
-	if err != nil {
-		log.Error(err)
+	feedbackID, ok := feedbackIDParam(c)
+	if !ok {
+		return
 	}
 
-	feedback, err := s.database.GetFeedbackByID(newID)
+	feedback, err := s.db(c).GetFeedbackByID(activeGame(c).ID, feedbackID)
 	if err != nil {
-		log.Error(err)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
 
-	c.JSON(http.StatusOK, feedback)
-}
-
-func (s *Server) MarkReadFeedback(c *gin.Context) {
-	tokenAccountID, err := security.GetTokenAccountID(s.config, c.GetHeader("Authorization"))
+	developer, err := s.callerIsDeveloper(c)
 	if err != nil {
-		log.WithFields(log.Fields{"err": err}).Error("Failed to get token.ID")
-		c.AbortWithStatus(http.StatusForbidden)
+		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	user, err := s.database.GetUserByID(*tokenAccountID)
-	if err != nil {log.Error(err)
-		c.AbortWithStatus(http.StatusUnauthorized)
+	if !developer {
+		if feedback.Status == lemon_api.FeedbackStatusQuarantined {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.JSON(http.StatusOK, feedback.Public())
 		return
 	}
+	c.JSON(http.StatusOK, feedback)
+}
 
-	if user.Role != lemon_api.DeveloperRole.Name {
-		c.AbortWithStatus(http.StatusUnauthorized)
+func (s *Server) MarkReadFeedback(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
 		return
 	}
 
@@ -171,7 +429,7 @@ func (s *Server) MarkReadFeedback(c *gin.Context) {
 		}).Error("Failed to convert ID to Int")
 		c.AbortWithStatus(http.StatusInternalServerError)
 	}
-	err = s.database.MarkReadFeedback(feedbackID)
+	err = s.db(c).MarkReadFeedback(activeGame(c).ID, feedbackID)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
@@ -190,6 +448,7 @@ func (s *Server) NewUser(c *gin.Context) {
 			"data": user,
 		}).Error("Failed to bind JSON")
 		c.AbortWithStatus(http.StatusBadRequest)
+		return
 	}
 
 	accountID := uuid.New().String()
@@ -201,34 +460,26 @@ func (s *Server) NewUser(c *gin.Context) {
 	user.Hash = bytes.NewBuffer(newHashSlice).String()
 
 	user.Role = lemon_api.UserRole.Name
+	user.Signature = security.SignSave(s.config, user.ID, user.SaveState)
 
-	_, err := s.database.NewUser(user)
+	game := activeGame(c)
+	_, err := s.db(c).NewUser(game.ID, user, notify.For(s.notifiers, lemon_api.WebhookEventUserRegistered))
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
 		}).Error("Failed to insert new user")
 		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
+	metrics.Registrations.Inc()
 
-	token, err := s.GenerateToken(user.Username, unHashed)
+	token, err := s.GenerateToken(c, game.ID, user.Username, unHashed)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
 		}).Error("Failed to generate token")
-	}
-
-	webhookBody, err := json.Marshal(map[string]string{
-		"username":   "Big Brother",
-		"avatar_url": "https://www.discordavatars.com/wp-content/uploads/2020/10/cctv-camera-avatar-150x150.jpg",
-		"content":    user.Username + " has joined the party!",
-	})
-	if err != nil {
-		log.Error(err)
-	}
-
-	hook, err := http.Post(s.config.Webhooks.NewUserURL, "application/json", bytes.NewBuffer(webhookBody))
-	if err != nil {
-		log.Error(err, hook)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
 
 	c.SetCookie("lemon-token", token.Value, 604800, "/", ".indiedev.io", true, false)
@@ -241,7 +492,7 @@ func (s *Server) UserAvailableCheck(c *gin.Context){
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	_, err := s.database.GetUserByUsername(username)
+	_, err := s.db(c).GetUserByUsername(activeGame(c).ID, username)
 	if err == nil {
 		c.AbortWithStatus(http.StatusConflict)
 		return
@@ -257,14 +508,23 @@ func (s *Server) Login(c *gin.Context) {
 			"data": loginRequest,
 		}).Error("Failed to bind JSON")
 		c.AbortWithStatus(http.StatusBadRequest)
+		return
 	}
 
-	token, err := s.GenerateToken(loginRequest.Username, loginRequest.Hash)
+	token, err := s.GenerateToken(c, activeGame(c).ID, loginRequest.Username, loginRequest.Hash)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
 		}).Error("Failed to generate token")
+		metrics.Logins.WithLabelValues(metrics.OutcomeFailure).Inc()
+		if err == security.ErrInvalidAccount || err == security.ErrInvalidCredentials {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
+	metrics.Logins.WithLabelValues(metrics.OutcomeSuccess).Inc()
 	c.SetCookie("lemon-token", token.Value, 604800, "/", ".indiedev.io", true, false)
 	c.JSON(http.StatusOK, token)
 }
@@ -282,12 +542,37 @@ func (s *Server) GetUser(c *gin.Context) {
 		return
 	}
 
-	data, err := s.database.GetUserByID(*tokenAccountID)
+	game := activeGame(c)
+	data, err := s.db(c).GetUserByID(game.ID, *tokenAccountID)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
 		}).Error("Failed to get user from database")
 		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if version := c.Query("version"); version != "" && data.SaveVersion != "" && version != data.SaveVersion {
+		save := lemon_api.Save{
+			GameID:      game.ID,
+			AccountID:   data.ID,
+			Slot:        lemon_api.DefaultSaveSlot,
+			SaveState:   data.SaveState,
+			Signature:   data.Signature,
+			SaveVersion: data.SaveVersion,
+		}
+		if status, err := s.upgradeSave(c, &save, version); err != nil {
+			log.WithFields(log.Fields{
+				"err":  err,
+				"from": data.SaveVersion,
+				"to":   version,
+			}).Error("Failed to upgrade save")
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		data.SaveState = save.SaveState
+		data.Signature = save.Signature
+		data.SaveVersion = save.SaveVersion
 	}
 	c.JSON(http.StatusOK, data)
 }
@@ -308,15 +593,32 @@ func (s *Server) UpdateUser(c *gin.Context) {
 		return
 	}
 	user.ID = *tokenAccountID
-	err = s.database.UpdateUser(user)
+
+	game := activeGame(c)
+	save := lemon_api.Save{
+		GameID:      game.ID,
+		AccountID:   user.ID,
+		Slot:        lemon_api.DefaultSaveSlot,
+		SaveState:   user.SaveState,
+		Signature:   user.Signature,
+		SaveVersion: user.SaveVersion,
+	}
+	if !s.checkSaveUpload(c, &save) {
+		return
+	}
+
+	user.Signature = save.Signature
+	err = s.db(c).UpdateUser(game.ID, user, notify.For(s.notifiers, lemon_api.WebhookEventSaveUpdated))
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
 		}).Error("Failed to update user in database")
 		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
+	metrics.SaveUploads.Inc()
 
-	c.AbortWithStatus(http.StatusOK)
+	c.JSON(http.StatusOK, lemon_api.SaveSignature{Signature: user.Signature})
 }
 
 func (s *Server) ElevateUser(c *gin.Context) {
@@ -333,7 +635,8 @@ func (s *Server) ElevateUser(c *gin.Context) {
 		return
 	}
 
-	user, err := s.database.GetUserByID(*tokenAccountID)
+	game := activeGame(c)
+	user, err := s.db(c).GetUserByID(game.ID, *tokenAccountID)
 	if err != nil {log.Error(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return}
@@ -344,11 +647,18 @@ func (s *Server) ElevateUser(c *gin.Context) {
 	}
 
 	user.Role = lemon_api.DeveloperRole.Name
-	err = s.database.ElevateUser(*user)
+	err = s.db(c).ElevateUser(*user)
 	if err != nil {log.Error(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return}
 
+	err = s.db(c).AddGameDeveloper(game.ID, user.ID)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
 	var token lemon_api.Token
 
 	tkn := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
@@ -380,7 +690,7 @@ func (s *Server) DeleteUser(c *gin.Context) {
 		c.AbortWithStatus(http.StatusForbidden)
 		return
 	}
-	err = s.database.DeleteUser(*tokenAccountID)
+	err = s.db(c).DeleteUser(*tokenAccountID)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
@@ -391,8 +701,85 @@ func (s *Server) DeleteUser(c *gin.Context) {
 	c.AbortWithStatus(http.StatusOK)
 }
 
-func (s *Server) GenerateToken(username string, hash string) (*lemon_api.Token, error) {
-	existingAccount, err := s.database.GetUserByUsername(username)
+// requireAccount resolves the caller's account ID from their token, aborting
+// the request when it is missing or invalid.
+func (s *Server) requireAccount(c *gin.Context) (string, bool) {
+	tokenAccountID, err := security.GetTokenAccountID(s.config, c.GetHeader("Authorization"))
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed to get token.ID")
+		c.AbortWithStatus(http.StatusForbidden)
+		return "", false
+	}
+	return *tokenAccountID, true
+}
+
+// optionalAccount returns the caller's account ID when they sent a token and
+// nil when they didn't, aborting only if the token they sent is invalid.
+func (s *Server) optionalAccount(c *gin.Context) (*string, bool) {
+	if c.GetHeader("Authorization") == "" {
+		return nil, true
+	}
+	accountID, ok := s.requireAccount(c)
+	if !ok {
+		return nil, false
+	}
+	return &accountID, true
+}
+
+// requireDeveloper resolves the caller from their token and aborts the request
+// unless they are assigned as a developer of the active game.
+func (s *Server) requireDeveloper(c *gin.Context) (*lemon_api.User, bool) {
+	tokenAccountID, err := security.GetTokenAccountID(s.config, c.GetHeader("Authorization"))
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Error("Failed to get token.ID")
+		c.AbortWithStatus(http.StatusForbidden)
+		return nil, false
+	}
+	game := activeGame(c)
+	user, err := s.db(c).GetUserByID(game.ID, *tokenAccountID)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	isDeveloper, err := s.db(c).IsGameDeveloper(game.ID, user.ID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	if !isDeveloper {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// callerIsDeveloper reports whether the request carries the token of one of
+// the active game's developers. Unlike requireDeveloper it doesn't abort, for
+// endpoints that show developers more than everyone else.
+func (s *Server) callerIsDeveloper(c *gin.Context) (bool, error) {
+	if c.GetHeader("Authorization") == "" {
+		return false, nil
+	}
+	tokenAccountID, err := security.GetTokenAccountID(s.config, c.GetHeader("Authorization"))
+	if err != nil {
+		return false, nil
+	}
+
+	isDeveloper, err := s.db(c).IsGameDeveloper(activeGame(c).ID, *tokenAccountID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to check game developer")
+		return false, err
+	}
+	return isDeveloper, nil
+}
+
+func (s *Server) GenerateToken(c *gin.Context, gameID string, username string, hash string) (*lemon_api.Token, error) {
+	existingAccount, err := s.db(c).GetUserByUsername(gameID, username)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, security.ErrInvalidAccount
@@ -410,6 +797,12 @@ func (s *Server) GenerateToken(username string, hash string) (*lemon_api.Token,
 		return nil, security.ErrInvalidCredentials
 	}
 
+	return s.signToken(existingAccount)
+}
+
+// signToken issues a lemon-token for an account whose identity has already
+// been established, either by password or an approved device code.
+func (s *Server) signToken(existingAccount *lemon_api.User) (*lemon_api.Token, error) {
 	var token lemon_api.Token
 
 	var role lemon_api.Role
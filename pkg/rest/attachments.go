@@ -0,0 +1,330 @@
+package rest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/security"
+	"lemon/lemon-api/pkg/storage"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAttachmentMaxSize   = 10 << 20
+	defaultAttachmentMaxFiles  = 5
+	defaultAttachmentURLExpiry = 15 * time.Minute
+
+	// feedbackFormOverhead is allowed on top of the attachments themselves for
+	// the feedback JSON and multipart framing.
+	feedbackFormOverhead = 1 << 20
+	maxFilenameLength    = 255
+)
+
+var defaultAttachmentTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"text/plain",
+	"application/zip",
+	"application/x-gzip",
+}
+
+type attachmentLimits struct {
+	maxSize      int64
+	maxFiles     int
+	allowedTypes []string
+	urlExpiry    time.Duration
+}
+
+// pendingAttachment is an uploaded file that passed validation but hasn't
+// been stored yet.
+type pendingAttachment struct {
+	header      *multipart.FileHeader
+	contentType string
+}
+
+func (s *Server) attachmentLimits() attachmentLimits {
+	limits := attachmentLimits{
+		maxSize:      defaultAttachmentMaxSize,
+		maxFiles:     defaultAttachmentMaxFiles,
+		allowedTypes: defaultAttachmentTypes,
+		urlExpiry:    defaultAttachmentURLExpiry,
+	}
+
+	cfg := s.config.Attachments
+	if cfg == nil {
+		return limits
+	}
+	if cfg.MaxSize > 0 {
+		limits.maxSize = cfg.MaxSize
+	}
+	if cfg.MaxFiles > 0 {
+		limits.maxFiles = cfg.MaxFiles
+	}
+	if len(cfg.AllowedTypes) > 0 {
+		limits.allowedTypes = cfg.AllowedTypes
+	}
+	if cfg.URLExpiry > 0 {
+		limits.urlExpiry = time.Duration(cfg.URLExpiry) * time.Second
+	}
+	return limits
+}
+
+func isMultipart(c *gin.Context) bool {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	return mediaType == "multipart/form-data"
+}
+
+// bindFeedbackForm reads feedback submitted as a multipart form: the feedback
+// JSON in the "feedback" field and any screenshots or logs as "attachments"
+// files. Every file is checked against the attachment limits before anything
+// is stored.
+func (s *Server) bindFeedbackForm(c *gin.Context, feedback *lemon_api.Feedback) ([]*pendingAttachment, bool) {
+	limits := s.attachmentLimits()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.maxSize*int64(limits.maxFiles)+feedbackFormOverhead)
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to parse feedback form")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid multipart form"})
+		return nil, false
+	}
+
+	values := form.Value["feedback"]
+	if len(values) != 1 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing feedback"})
+		return nil, false
+	}
+	if err := json.Unmarshal([]byte(values[0]), feedback); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid feedback"})
+		return nil, false
+	}
+
+	files := form.File["attachments"]
+	if len(files) > limits.maxFiles {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d attachments are allowed", limits.maxFiles)})
+		return nil, false
+	}
+
+	pending := make([]*pendingAttachment, 0, len(files))
+	for _, header := range files {
+		if header.Size > limits.maxSize {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("%s is larger than %d bytes", header.Filename, limits.maxSize)})
+			return nil, false
+		}
+
+		contentType, err := sniffContentType(header)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unreadable attachment"})
+			return nil, false
+		}
+		if !allowedType(limits.allowedTypes, contentType) {
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": fmt.Sprintf("%s has unsupported type %s", header.Filename, contentType)})
+			return nil, false
+		}
+
+		pending = append(pending, &pendingAttachment{header: header, contentType: contentType})
+	}
+
+	return pending, true
+}
+
+// sniffContentType decides the type from the file's contents rather than
+// trusting the type the client claims.
+func sniffContentType(header *multipart.FileHeader) (string, error) {
+	f, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, err := f.Read(buf)
+	if err != nil && n == 0 && header.Size > 0 {
+		return "", err
+	}
+
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	if err != nil {
+		return "", err
+	}
+	return mediaType, nil
+}
+
+func allowedType(allowed []string, contentType string) bool {
+	for _, t := range allowed {
+		if strings.EqualFold(t, contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// storeAttachments puts validated uploads into blob storage ahead of the
+// feedback they were submitted with, returning the rows to record alongside
+// it. If any upload fails, those already stored are deleted again.
+func (s *Server) storeAttachments(c *gin.Context, gameID string, pending []*pendingAttachment) ([]lemon_api.FeedbackAttachment, bool) {
+	attachments := make([]lemon_api.FeedbackAttachment, 0, len(pending))
+	for _, p := range pending {
+		key := fmt.Sprintf("games/%s/feedback/%s", gameID, uuid.New().String())
+
+		f, err := p.header.Open()
+		if err != nil {
+			log.WithFields(log.Fields{"err": err}).Error("Failed to open attachment")
+			s.deleteAttachments(attachments)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return nil, false
+		}
+		err = s.storage.Put(key, p.contentType, p.header.Size, f)
+		f.Close()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+				"key": key,
+			}).Error("Failed to store attachment")
+			s.deleteAttachments(attachments)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return nil, false
+		}
+
+		attachments = append(attachments, lemon_api.FeedbackAttachment{
+			Filename:    attachmentFilename(p.header.Filename),
+			ContentType: p.contentType,
+			Size:        p.header.Size,
+			StorageKey:  key,
+		})
+	}
+	return attachments, true
+}
+
+// deleteAttachments removes stored uploads whose feedback was never saved.
+func (s *Server) deleteAttachments(attachments []lemon_api.FeedbackAttachment) {
+	for _, attachment := range attachments {
+		if err := s.storage.Delete(attachment.StorageKey); err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+				"key": attachment.StorageKey,
+			}).Error("Failed to delete orphaned attachment")
+		}
+	}
+}
+
+// attachmentFilename keeps only the base name a client sent, since some
+// browsers include the full local path.
+func attachmentFilename(filename string) string {
+	filename = path.Base(strings.Replace(filename, "\\", "/", -1))
+	if filename == "." || filename == "/" {
+		filename = "attachment"
+	}
+	if len(filename) > maxFilenameLength {
+		filename = filename[len(filename)-maxFilenameLength:]
+	}
+	return filename
+}
+
+// GetFeedbackAttachments lists the files attached to feedback, each with a
+// signed download URL that expires after the configured time.
+func (s *Server) GetFeedbackAttachments(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	feedbackID, ok := feedbackIDParam(c)
+	if !ok {
+		return
+	}
+
+	game := activeGame(c)
+	attachments, err := s.db(c).GetFeedbackAttachments(game.ID, feedbackID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	expires := time.Now().Add(s.attachmentLimits().urlExpiry).Unix()
+	for _, attachment := range attachments {
+		attachment.URL = fmt.Sprintf("/api/games/%s/feedback/%d/attachments/%d?expires=%d&signature=%s",
+			game.Slug, feedbackID, attachment.ID, expires,
+			security.SignAttachment(s.config, game.ID, attachment.ID, expires))
+	}
+
+	if attachments == nil {
+		attachments = []*lemon_api.FeedbackAttachment{}
+	}
+	c.JSON(http.StatusOK, attachments)
+}
+
+// DownloadFeedbackAttachment serves an attachment to a developer, who either
+// sends their token or follows a signed URL from GetFeedbackAttachments.
+func (s *Server) DownloadFeedbackAttachment(c *gin.Context) {
+	feedbackID, ok := feedbackIDParam(c)
+	if !ok {
+		return
+	}
+	attachmentID, err := strconv.ParseInt(c.Param("attachmentID"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid attachment ID"})
+		return
+	}
+
+	game := activeGame(c)
+	if signature := c.Query("signature"); signature != "" {
+		expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": security.ErrInvalidAttachmentURL.Error()})
+			return
+		}
+		if err := security.VerifyAttachment(s.config, game.ID, attachmentID, expires, signature); err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+	} else if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	attachment, err := s.db(c).GetFeedbackAttachment(game.ID, feedbackID, attachmentID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to get feedback attachment")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	blob, err := s.storage.Get(attachment.StorageKey)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		log.WithFields(log.Fields{
+			"err": err,
+			"key": attachment.StorageKey,
+		}).Error("Failed to read attachment")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, blob, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}),
+		"X-Content-Type-Options": "nosniff",
+	})
+}
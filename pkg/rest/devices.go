@@ -0,0 +1,186 @@
+package rest
+
+import (
+	"database/sql"
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/security"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	userCodeLength     = 8
+	deviceCodeExpiry   = time.Minute * 10
+	devicePollInterval = time.Second * 5
+)
+
+// NewDeviceCode starts the device authorisation flow for a console or TV. The
+// device shows the user code to the player and polls DeviceToken with the
+// device code until the player approves it from a signed in session.
+func (s *Server) NewDeviceCode(c *gin.Context) {
+	if err := s.db(c).DeleteExpiredDeviceCodes(); err != nil {
+		log.Error(err)
+	}
+
+	userCode, err := security.RandomCode(userCodeLength)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to generate user code")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	expires := now.Add(deviceCodeExpiry)
+	code := lemon_api.DeviceCode{
+		DeviceCode: uuid.New().String(),
+		UserCode:   userCode,
+		Status:     lemon_api.DeviceCodePending,
+		Created:    &now,
+		Expires:    &expires,
+	}
+
+	if err := s.db(c).InsertDeviceCode(code); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to insert device code")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, lemon_api.DeviceCodeResponse{
+		DeviceCode:      code.DeviceCode,
+		UserCode:        userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:],
+		VerificationURI: s.config.Security.DeviceVerifyURL,
+		ExpiresIn:       int64(deviceCodeExpiry.Seconds()),
+		Interval:        int64(devicePollInterval.Seconds()),
+	})
+}
+
+func (s *Server) ApproveDeviceCode(c *gin.Context) {
+	s.resolveDeviceCode(c, lemon_api.DeviceCodeApproved)
+}
+
+func (s *Server) DenyDeviceCode(c *gin.Context) {
+	s.resolveDeviceCode(c, lemon_api.DeviceCodeDenied)
+}
+
+func (s *Server) resolveDeviceCode(c *gin.Context, status string) {
+	var request lemon_api.DeviceApprovalRequest
+	if err := c.BindJSON(&request); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	accountID, ok := s.requireAccount(c)
+	if !ok {
+		return
+	}
+
+	userCode := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(request.UserCode))
+	resolved, err := s.db(c).ResolveDeviceCode(userCode, accountID, status)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to resolve device code")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !resolved {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	c.AbortWithStatus(http.StatusOK)
+}
+
+// DeviceToken is polled by the device. Errors follow the OAuth device grant so
+// existing client libraries know when to keep polling and when to give up.
+func (s *Server) DeviceToken(c *gin.Context) {
+	var request lemon_api.DeviceTokenRequest
+	if err := c.BindJSON(&request); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	code, err := s.db(c).GetDeviceCode(request.DeviceCode)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+			return
+		}
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to get device code")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	if now.After(*code.Expires) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "expired_token"})
+		return
+	}
+
+	switch code.Status {
+	case lemon_api.DeviceCodeDenied:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "access_denied"})
+		return
+	case lemon_api.DeviceCodeConsumed:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	case lemon_api.DeviceCodePending:
+		if err := s.db(c).PollDeviceCode(code.DeviceCode); err != nil {
+			log.Error(err)
+		}
+		if code.LastPolled != nil && now.Sub(*code.LastPolled) < devicePollInterval {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "slow_down"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "authorization_pending"})
+		return
+	}
+
+	accountID, err := s.db(c).ConsumeDeviceCode(code.DeviceCode)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+			return
+		}
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to consume device code")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	user, err := s.db(c).GetUserByID(activeGame(c).ID, accountID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	token, err := s.signToken(user)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to generate token")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.SetCookie("lemon-token", token.Value, 604800, "/", ".indiedev.io", true, false)
+	c.JSON(http.StatusOK, token)
+}
@@ -0,0 +1,307 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/export"
+	"lemon/lemon-api/pkg/postgres"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// feedbackFilterFromQuery reads the listing filters shared by the feedback
+// endpoints from the query string.
+func feedbackFilterFromQuery(c *gin.Context) (lemon_api.FeedbackFilter, error) {
+	filter := lemon_api.FeedbackFilter{
+		GameID:    activeGame(c).ID,
+		Type:      c.Query("type"),
+		Status:    c.Query("status"),
+		Build:     c.Query("build"),
+		Sort:      c.Query("sort"),
+		Order:     c.Query("order"),
+		Cursor:    c.Query("cursor"),
+		Platform:  c.Query("platform"),
+		Locale:    c.Query("locale"),
+		Scene:     c.Query("scene"),
+		SessionID: c.Query("session_id"),
+	}
+
+	if value := c.Query("context"); value != "" {
+		if err := json.Unmarshal([]byte(value), &filter.Context); err != nil {
+			return filter, errors.New("context must be a JSON object")
+		}
+	}
+
+	if value := c.Query("min_rating"); value != "" {
+		rating, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return filter, errors.New("min_rating must be a whole number")
+		}
+		filter.MinRating = &rating
+	}
+
+	if value := c.Query("max_rating"); value != "" {
+		rating, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return filter, errors.New("max_rating must be a whole number")
+		}
+		filter.MaxRating = &rating
+	}
+
+	if value := c.Query("read"); value != "" {
+		read, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, errors.New("read must be true or false")
+		}
+		filter.Read = &read
+	}
+
+	if value := c.Query("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, errors.New("from must be an RFC 3339 timestamp")
+		}
+		from = from.UTC()
+		filter.From = &from
+	}
+
+	if value := c.Query("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, errors.New("to must be an RFC 3339 timestamp")
+		}
+		to = to.UTC()
+		filter.To = &to
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return filter, errors.New("limit must be a positive number")
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+// maxFeedbackMetadataSize caps the encoded metadata a game may attach to a
+// single piece of feedback.
+const maxFeedbackMetadataSize = 16 << 10
+
+func validateFeedbackMetadata(metadata lemon_api.FeedbackMetadata) error {
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return errors.New("invalid metadata")
+	}
+	if len(b) > maxFeedbackMetadataSize {
+		return fmt.Errorf("metadata must be at most %d bytes", maxFeedbackMetadataSize)
+	}
+	return nil
+}
+
+// feedbackIDParam parses the :ID path segment, aborting the request if it
+// isn't a feedback ID.
+func feedbackIDParam(c *gin.Context) (int64, bool) {
+	feedbackID, err := strconv.ParseInt(c.Param("ID"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid feedback ID"})
+		return 0, false
+	}
+	return feedbackID, true
+}
+
+// SearchFeedback runs a ranked full text search over feedback descriptions for
+// developers. It accepts the same filters as GetFeedback and pages with limit
+// and offset.
+func (s *Server) SearchFeedback(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	search := strings.TrimSpace(c.Query("q"))
+	if search == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing q"})
+		return
+	}
+
+	filter, err := feedbackFilterFromQuery(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	offset := 0
+	if value := c.Query("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "offset must be zero or more"})
+			return
+		}
+	}
+
+	results, total, err := s.db(c).SearchFeedback(filter, search, offset)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to search feedback")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	if results == nil {
+		results = []*lemon_api.FeedbackSearchResult{}
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// defaultStatsRange is how far back stats look when no from is given.
+const defaultStatsRange = 30 * 24 * time.Hour
+
+// GetFeedbackStats summarises feedback for developers: rating averages and
+// distribution, counts per type, unread counts and a day or week series. It
+// takes the listing filters, plus bucket and by_build=true for a per-build
+// breakdown.
+func (s *Server) GetFeedbackStats(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	filter, err := feedbackFilterFromQuery(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.From == nil {
+		from := time.Now().UTC().Add(-defaultStatsRange)
+		if filter.To != nil {
+			from = filter.To.Add(-defaultStatsRange)
+		}
+		filter.From = &from
+	}
+
+	bucket := c.DefaultQuery("bucket", postgres.StatsBucketDay)
+
+	byBuild := false
+	if value := c.Query("by_build"); value != "" {
+		if byBuild, err = strconv.ParseBool(value); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "by_build must be true or false"})
+			return
+		}
+	}
+
+	stats, err := s.db(c).FeedbackStats(filter, bucket, byBuild)
+	if err != nil {
+		if err == postgres.ErrInvalidBucket {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "bucket must be day or week"})
+			return
+		}
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to get feedback stats")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// exportFlushRows is how many rows are written between flushes while an
+// export streams to the client.
+const exportFlushRows = 100
+
+// ExportFeedback streams every piece of feedback matching the listing filters
+// as CSV or newline delimited JSON.
+func (s *Server) ExportFeedback(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	filter, err := feedbackFilterFromQuery(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := c.DefaultQuery("format", export.FormatCSV)
+	writer, err := export.NewFeedbackWriter(format, c.Writer)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson"})
+		return
+	}
+
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=feedback-%s.%s", activeGame(c).Slug, format))
+
+	rows := 0
+	err = s.db(c).ExportFeedback(filter, func(feedback *lemon_api.Feedback) error {
+		if err := writer.Write(feedback); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err":  err,
+			"rows": rows,
+		}).Error("Failed to export feedback")
+		if !c.Writer.Written() {
+			if err == postgres.ErrInvalidSort {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}
+	}
+}
+
+// recentFeedbackLimit caps how much recent feedback new submissions are
+// compared against when looking for duplicates.
+const recentFeedbackLimit = 200
+
+// screenFeedback quarantines feedback that trips the spam rules or nearly
+// repeats something submitted recently, recording why.
+func (s *Server) screenFeedback(c *gin.Context, feedback *lemon_api.Feedback) error {
+	feedback.Status = lemon_api.FeedbackStatusNew
+	feedback.QuarantineReason = nil
+	feedback.DuplicateOf = nil
+
+	reason := s.spam.Check(feedback)
+	if reason == "" {
+		recent, err := s.db(c).GetRecentFeedback(feedback.GameID, time.Now().UTC().Add(-s.spam.Window()), recentFeedbackLimit)
+		if err != nil {
+			return err
+		}
+		if duplicateOf, ok := s.spam.DuplicateOf(feedback.Description, recent); ok {
+			feedback.DuplicateOf = &duplicateOf
+			reason = fmt.Sprintf("near duplicate of %d", duplicateOf)
+		}
+	}
+
+	if reason != "" {
+		log.WithFields(log.Fields{
+			"game":   feedback.GameID,
+			"reason": reason,
+		}).Info("Quarantined feedback")
+		feedback.Status = lemon_api.FeedbackStatusQuarantined
+		feedback.QuarantineReason = &reason
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package rest
+
+import (
+	"database/sql"
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/security"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	gameKeyHeader  = "X-Lemon-Game-Key"
+	gameContextKey = "game"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// gameFromKey resolves the active game from the API key header, falling back
+// to the configured default game so single game clients keep working.
+func (s *Server) gameFromKey(c *gin.Context) {
+	var game *lemon_api.Game
+	var err error
+
+	if key := c.GetHeader(gameKeyHeader); key != "" {
+		game, err = s.db(c).GetGameByAPIKey(key)
+	} else if s.config.API.DefaultGame != "" {
+		game, err = s.db(c).GetGameBySlug(s.config.API.DefaultGame)
+	} else {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing " + gameKeyHeader + " header"})
+		return
+	}
+
+	s.setActiveGame(c, game, err)
+}
+
+// gameFromPath resolves the active game from the :game path segment.
+func (s *Server) gameFromPath(c *gin.Context) {
+	game, err := s.db(c).GetGameBySlug(c.Param("game"))
+	s.setActiveGame(c, game, err)
+}
+
+func (s *Server) setActiveGame(c *gin.Context, game *lemon_api.Game, err error) {
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown game"})
+			return
+		}
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to get game from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Set(gameContextKey, game)
+	c.Next()
+}
+
+// activeGame returns the game resolved by gameFromKey or gameFromPath. Those
+// abort the request when there's no game, so handlers registered with
+// registerGameRoutes always have one; anywhere else is a programming error.
+func activeGame(c *gin.Context) *lemon_api.Game {
+	game, ok := c.Get(gameContextKey)
+	if !ok {
+		panic("activeGame: " + c.FullPath() + " is not registered with registerGameRoutes")
+	}
+	return game.(*lemon_api.Game)
+}
+
+// NewGame registers a new game. Any account holding the developer role may
+// create one and becomes its first developer.
+func (s *Server) NewGame(c *gin.Context) {
+	var game lemon_api.Game
+	if err := c.BindJSON(&game); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	accountID, ok := s.requireAccount(c)
+	if !ok {
+		return
+	}
+
+	user, err := s.db(c).GetUserByID("", accountID)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if user.Role != lemon_api.DeveloperRole.Name {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if !slugPattern.MatchString(game.Slug) || game.Name == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "games need a name and a lowercase slug of letters, numbers and dashes"})
+		return
+	}
+
+	if _, err := s.db(c).GetGameBySlug(game.Slug); err == nil {
+		c.AbortWithStatus(http.StatusConflict)
+		return
+	} else if err != sql.ErrNoRows {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	apiKey, err := security.NewAPIKey()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to generate API key")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	game.ID = uuid.New().String()
+	game.APIKey = apiKey
+	game.SharingEnabled = true
+	game.Created = &now
+
+	if err := s.db(c).InsertGame(game, user.ID); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to insert game")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, game)
+}
+
+// GetGames lists the games the caller is a developer of.
+func (s *Server) GetGames(c *gin.Context) {
+	accountID, ok := s.requireAccount(c)
+	if !ok {
+		return
+	}
+
+	games, err := s.db(c).GetDeveloperGames(accountID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to get games from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, games)
+}
+
+func (s *Server) AddGameDeveloper(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	var request lemon_api.GameDeveloperRequest
+	if err := c.BindJSON(&request); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	game := activeGame(c)
+	user, err := s.db(c).GetUserByUsername(game.ID, request.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.db(c).AddGameDeveloper(game.ID, user.ID); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.AbortWithStatus(http.StatusOK)
+}
+
+func (s *Server) RemoveGameDeveloper(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	if err := s.db(c).RemoveGameDeveloper(activeGame(c).ID, c.Param("accountID")); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.AbortWithStatus(http.StatusOK)
+}
@@ -0,0 +1,129 @@
+package rest
+
+import (
+	"context"
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/postgres"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	readinessTimeout = 2 * time.Second
+	// backlogWarnAge is how long a due delivery can wait before the webhook
+	// check reports degraded. A slow destination doesn't make the API unready.
+	backlogWarnAge = 15 * time.Minute
+)
+
+// GetHealth answers as long as the process is serving requests.
+func (s *Server) GetHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": lemon_api.HealthStatusOK})
+}
+
+// GetReadiness checks the database can be reached and is migrated, and how
+// far behind webhook delivery is. It answers 503 when the API can't serve.
+func (s *Server) GetReadiness(c *gin.Context) {
+	readiness := lemon_api.Readiness{
+		Status: lemon_api.HealthStatusOK,
+		Checks: map[string]*lemon_api.HealthCheck{},
+	}
+
+	if atomic.LoadInt32(&s.ready) == 0 {
+		readiness.Status = lemon_api.HealthStatusUnavailable
+		readiness.Checks["database"] = &lemon_api.HealthCheck{
+			Status: lemon_api.HealthStatusUnavailable,
+			Error:  "not connected",
+		}
+		c.JSON(http.StatusServiceUnavailable, readiness)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	readiness.Checks["database"] = s.checkDatabase(ctx)
+	readiness.Checks["migrations"] = s.checkMigrations(ctx)
+	readiness.Checks["webhooks"] = s.checkWebhooks(ctx)
+
+	status := http.StatusOK
+	for _, check := range readiness.Checks {
+		switch check.Status {
+		case lemon_api.HealthStatusUnavailable:
+			readiness.Status = lemon_api.HealthStatusUnavailable
+			status = http.StatusServiceUnavailable
+		case lemon_api.HealthStatusDegraded:
+			if readiness.Status == lemon_api.HealthStatusOK {
+				readiness.Status = lemon_api.HealthStatusDegraded
+			}
+		}
+	}
+	c.JSON(status, readiness)
+}
+
+func (s *Server) checkDatabase(ctx context.Context) *lemon_api.HealthCheck {
+	started := time.Now()
+	if err := s.database.Ping(ctx); err != nil {
+		return &lemon_api.HealthCheck{
+			Status: lemon_api.HealthStatusUnavailable,
+			Error:  err.Error(),
+		}
+	}
+	latency := int64(time.Since(started) / time.Millisecond)
+	return &lemon_api.HealthCheck{
+		Status:    lemon_api.HealthStatusOK,
+		LatencyMS: &latency,
+	}
+}
+
+// checkMigrations is unavailable while the database is behind the code or a
+// migration failed. A newer schema is fine, as it is during a rolling deploy.
+func (s *Server) checkMigrations(ctx context.Context) *lemon_api.HealthCheck {
+	expected := int64(postgres.SchemaVersion)
+	version, dirty, err := s.database.GetSchemaVersion(ctx)
+	if err != nil {
+		return &lemon_api.HealthCheck{
+			Status:          lemon_api.HealthStatusUnavailable,
+			Error:           err.Error(),
+			ExpectedVersion: &expected,
+		}
+	}
+
+	check := &lemon_api.HealthCheck{
+		Status:          lemon_api.HealthStatusOK,
+		Version:         &version,
+		ExpectedVersion: &expected,
+		Dirty:           &dirty,
+	}
+	switch {
+	case dirty:
+		check.Status = lemon_api.HealthStatusUnavailable
+		check.Error = "last migration failed"
+	case version < expected:
+		check.Status = lemon_api.HealthStatusUnavailable
+		check.Error = "migrations pending"
+	}
+	return check
+}
+
+func (s *Server) checkWebhooks(ctx context.Context) *lemon_api.HealthCheck {
+	backlog, err := s.database.GetWebhookBacklog(ctx)
+	if err != nil {
+		return &lemon_api.HealthCheck{
+			Status: lemon_api.HealthStatusDegraded,
+			Error:  err.Error(),
+		}
+	}
+
+	check := &lemon_api.HealthCheck{
+		Status:  lemon_api.HealthStatusOK,
+		Backlog: backlog,
+	}
+	if backlog.OldestDue != nil && time.Since(*backlog.OldestDue) > backlogWarnAge {
+		check.Status = lemon_api.HealthStatusDegraded
+		check.Error = "webhook deliveries are falling behind"
+	}
+	return check
+}
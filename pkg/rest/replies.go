@@ -0,0 +1,139 @@
+package rest
+
+import (
+	lemon_api "lemon/lemon-api"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetMyFeedback lists the feedback the caller submitted while signed in, with
+// its status, the replies to it and a count of unread developer replies.
+func (s *Server) GetMyFeedback(c *gin.Context) {
+	accountID, ok := s.requireAccount(c)
+	if !ok {
+		return
+	}
+
+	feedback, err := s.db(c).GetAccountFeedback(activeGame(c).ID, accountID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if feedback == nil {
+		feedback = []*lemon_api.PlayerFeedback{}
+	}
+	c.JSON(http.StatusOK, feedback)
+}
+
+// GetFeedbackReplies returns the reply thread on feedback to a developer or
+// to the player who submitted it. A player reading the thread marks the
+// developers' replies read.
+func (s *Server) GetFeedbackReplies(c *gin.Context) {
+	feedback, _, fromDeveloper, ok := s.feedbackParticipant(c)
+	if !ok {
+		return
+	}
+
+	gameID := activeGame(c).ID
+	replies, err := s.db(c).GetFeedbackReplies(gameID, feedback.ID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if !fromDeveloper {
+		if err := s.db(c).MarkFeedbackRepliesRead(gameID, feedback.ID); err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if replies == nil {
+		replies = []*lemon_api.FeedbackReply{}
+	}
+	c.JSON(http.StatusOK, replies)
+}
+
+// AddFeedbackReply adds a message to the reply thread on feedback, from either
+// a developer or the player who submitted it.
+func (s *Server) AddFeedbackReply(c *gin.Context) {
+	feedback, user, fromDeveloper, ok := s.feedbackParticipant(c)
+	if !ok {
+		return
+	}
+
+	var reply lemon_api.FeedbackReply
+	if err := c.BindJSON(&reply); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(reply.Body) == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "reply body is empty"})
+		return
+	}
+
+	reply.FeedbackID = feedback.ID
+	reply.AuthorID = &user.ID
+	reply.Author = user.Username
+	reply.FromDeveloper = fromDeveloper
+	reply.PlayerRead = !fromDeveloper
+
+	replyID, err := s.db(c).InsertFeedbackReply(reply)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	reply.ID = replyID
+	c.JSON(http.StatusOK, reply)
+}
+
+// feedbackParticipant loads the feedback named in the path and the caller,
+// aborting unless the caller is a developer of the game or the player who
+// submitted the feedback.
+func (s *Server) feedbackParticipant(c *gin.Context) (*lemon_api.Feedback, *lemon_api.User, bool, bool) {
+	accountID, ok := s.requireAccount(c)
+	if !ok {
+		return nil, nil, false, false
+	}
+
+	feedbackID, ok := feedbackIDParam(c)
+	if !ok {
+		return nil, nil, false, false
+	}
+
+	gameID := activeGame(c).ID
+	user, err := s.db(c).GetUserByID(gameID, accountID)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return nil, nil, false, false
+	}
+
+	feedback, ok := s.findFeedback(c, gameID, feedbackID)
+	if !ok {
+		return nil, nil, false, false
+	}
+
+	isDeveloper, err := s.db(c).IsGameDeveloper(gameID, user.ID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, nil, false, false
+	}
+	if isDeveloper {
+		return feedback, user, true, true
+	}
+
+	if feedback.AccountID == nil || *feedback.AccountID != user.ID {
+		c.AbortWithStatus(http.StatusForbidden)
+		return nil, nil, false, false
+	}
+	return feedback, user, false, true
+}
@@ -0,0 +1,321 @@
+package rest
+
+import (
+	"database/sql"
+	"errors"
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/metrics"
+	"lemon/lemon-api/pkg/notify"
+	"lemon/lemon-api/pkg/savestate"
+	"lemon/lemon-api/pkg/security"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+func (s *Server) GetSaveVerificationReport(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	report, err := s.db(c).GetSaveFailureReport(activeGame(c).ID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to get save verification report from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (s *Server) UpsertSaveSchema(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	var schema lemon_api.SaveSchema
+	if err := c.BindJSON(&schema); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if schema.Version == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing version"})
+		return
+	}
+
+	if err := savestate.CompileSchema(schema.Schema); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schema.GameID = activeGame(c).ID
+	if err := s.db(c).UpsertSaveSchema(schema); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to store save schema")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.AbortWithStatus(http.StatusOK)
+}
+
+func (s *Server) GetSaveSchemas(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	schemas, err := s.db(c).GetSaveSchemas(activeGame(c).ID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to get save schemas from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, schemas)
+}
+
+func (s *Server) UpsertSaveMigration(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	var migration lemon_api.SaveMigration
+	if err := c.BindJSON(&migration); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if migration.FromVersion == "" || migration.ToVersion == "" || migration.FromVersion == migration.ToVersion {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "from_version and to_version must be distinct versions"})
+		return
+	}
+
+	if migration.Kind == "" {
+		migration.Kind = savestate.TransformKind
+	}
+
+	if _, err := savestate.NewMigration(migration.Kind, migration.Definition); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	migration.GameID = activeGame(c).ID
+	if err := s.db(c).UpsertSaveMigration(migration); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to store save migration")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.AbortWithStatus(http.StatusOK)
+}
+
+func (s *Server) GetSaveMigrations(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	migrations, err := s.db(c).GetSaveMigrations(activeGame(c).ID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to get save migrations from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, migrations)
+}
+
+// validateSave checks a save against the schema registered for its version,
+// returning the status code to respond with when it doesn't pass.
+func (s *Server) validateSave(c *gin.Context, gameID string, version string, saveState string) (int, error) {
+	schema, err := s.db(c).GetSaveSchema(gameID, version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return http.StatusBadRequest, errors.New("no schema registered for save version " + version)
+		}
+		return http.StatusInternalServerError, err
+	}
+
+	if err := savestate.Validate(schema.Schema, saveState); err != nil {
+		return http.StatusUnprocessableEntity, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// checkSaveUpload verifies the signature and schema of an uploaded save,
+// aborting the request if it must be rejected. On success the save is re-signed
+// ready to be stored.
+// Only the server can sign a save, so an upload can't carry a signature for its
+// own new state. It presents the one issued for the save stored in the slot
+// instead, showing it was built from that; an empty slot needs none.
+func (s *Server) checkSaveUpload(c *gin.Context, save *lemon_api.Save) bool {
+	stored, err := s.db(c).GetSave(save.GameID, save.AccountID, save.Slot)
+	if err != nil && err != sql.ErrNoRows {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to get save from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+
+	if stored != nil && (save.Signature != "" || s.config.Security.RequireSignedSaves) {
+		if err := security.VerifySave(s.config, save.AccountID, stored.SaveState, save.Signature); err != nil {
+			log.WithFields(log.Fields{
+				"err":  err,
+				"id":   save.AccountID,
+				"slot": save.Slot,
+			}).Warn("Save failed signature verification")
+			if err := s.db(c).InsertSaveFailure(save.GameID, save.AccountID, err.Error()); err != nil {
+				log.Error(err)
+			}
+			if s.config.Security.RequireSignedSaves {
+				c.AbortWithStatus(http.StatusForbidden)
+				return false
+			}
+		}
+	}
+
+	if save.SaveVersion != "" {
+		if status, err := s.validateSave(c, save.GameID, save.SaveVersion, save.SaveState); err != nil {
+			log.WithFields(log.Fields{
+				"err":     err,
+				"version": save.SaveVersion,
+			}).Warn("Save failed schema validation")
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return false
+		}
+	}
+
+	save.Signature = security.SignSave(s.config, save.AccountID, save.SaveState)
+	return true
+}
+
+// upgradeSave migrates a stored save to the requested build version, re-signs
+// it and persists the result so the chain only runs once.
+func (s *Server) upgradeSave(c *gin.Context, save *lemon_api.Save, version string) (int, error) {
+	migrations, err := s.db(c).GetSaveMigrations(save.GameID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	upgraded, err := savestate.Upgrade(migrations, save.SaveVersion, version, save.SaveState)
+	if err != nil {
+		return http.StatusConflict, err
+	}
+
+	if _, err := s.db(c).GetSaveSchema(save.GameID, version); err == nil {
+		if status, err := s.validateSave(c, save.GameID, version, upgraded); err != nil {
+			return status, err
+		}
+	} else if err != sql.ErrNoRows {
+		return http.StatusInternalServerError, err
+	}
+
+	save.SaveState = upgraded
+	save.SaveVersion = version
+	save.Signature = security.SignSave(s.config, save.AccountID, save.SaveState)
+
+	if err := s.db(c).UpsertSave(*save, notify.For(s.notifiers, lemon_api.WebhookEventSaveUpdated)); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+func (s *Server) GetSaves(c *gin.Context) {
+	accountID, ok := s.requireAccount(c)
+	if !ok {
+		return
+	}
+
+	saves, err := s.db(c).GetSaves(activeGame(c).ID, accountID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to get saves from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, saves)
+}
+
+func (s *Server) GetSave(c *gin.Context) {
+	accountID, ok := s.requireAccount(c)
+	if !ok {
+		return
+	}
+
+	save, err := s.db(c).GetSave(activeGame(c).ID, accountID, c.Param("slot"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to get save from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if version := c.Query("version"); version != "" && save.SaveVersion != "" && version != save.SaveVersion {
+		if status, err := s.upgradeSave(c, save, version); err != nil {
+			log.WithFields(log.Fields{
+				"err":  err,
+				"from": save.SaveVersion,
+				"to":   version,
+			}).Error("Failed to upgrade save")
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, save)
+}
+
+func (s *Server) UpdateSave(c *gin.Context) {
+	var save lemon_api.Save
+	if err := c.BindJSON(&save); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	accountID, ok := s.requireAccount(c)
+	if !ok {
+		return
+	}
+	save.GameID = activeGame(c).ID
+	save.AccountID = accountID
+	save.Slot = c.Param("slot")
+
+	if !s.checkSaveUpload(c, &save) {
+		return
+	}
+
+	if err := s.db(c).UpsertSave(save, notify.For(s.notifiers, lemon_api.WebhookEventSaveUpdated)); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to update save in database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	metrics.SaveUploads.Inc()
+
+	c.JSON(http.StatusOK, lemon_api.SaveSignature{Signature: save.Signature})
+}
@@ -0,0 +1,199 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"lemon/lemon-api/pkg/config"
+	"lemon/lemon-api/pkg/postgres"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultReadTimeout       = 30 * time.Second
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultWriteTimeout      = 5 * time.Minute
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultShutdownTimeout   = 30 * time.Second
+
+	defaultStartupTimeout = time.Minute
+	baseConnectDelay      = time.Second
+	maxConnectDelay       = 30 * time.Second
+)
+
+func newHTTPServer(cfg *config.APIConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf("%v:%v", "0.0.0.0", cfg.Port),
+		Handler:           handler,
+		ReadTimeout:       seconds(cfg.ReadTimeout, defaultReadTimeout),
+		ReadHeaderTimeout: seconds(cfg.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		WriteTimeout:      seconds(cfg.WriteTimeout, defaultWriteTimeout),
+		IdleTimeout:       seconds(cfg.IdleTimeout, defaultIdleTimeout),
+	}
+}
+
+// Run serves the API on the configured port until Shutdown is called, when it
+// returns nil.
+func (s *Server) Run() error {
+	if err := s.httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// ShutdownTimeout is how long Shutdown should be given to drain requests and
+// stop the background workers.
+func (s *Server) ShutdownTimeout() time.Duration {
+	return seconds(s.config.API.ShutdownTimeout, defaultShutdownTimeout)
+}
+
+// Shutdown stops accepting connections and waits for requests in flight, then
+// stops the webhook dispatcher and digest scheduler, closes the database once
+// both have stopped and exports any spans still buffered.
+// Anything still running when ctx ends is abandoned; deliveries left claimed
+// are picked up again once their lease runs out.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var shutdownErr error
+	if s.stopConnecting != nil {
+		s.stopConnecting()
+	}
+	if s.connecting != nil {
+		<-s.connecting
+	}
+
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("unable to drain HTTP connections")
+		shutdownErr = err
+	}
+
+	workersStopped := true
+	if s.digests != nil {
+		if err := stopWithin(ctx, s.digests.Stop); err != nil {
+			log.Warn("digest scheduler did not stop in time")
+			shutdownErr = err
+			workersStopped = false
+		}
+	}
+	if s.dispatcher != nil {
+		if err := stopWithin(ctx, s.dispatcher.Stop); err != nil {
+			log.Warn("webhook dispatcher did not stop in time")
+			shutdownErr = err
+			workersStopped = false
+		}
+	}
+
+	// Closing the database under a worker that is still running would fail
+	// its queries part way through, so it is left for the process exit.
+	if s.database != nil && !workersStopped {
+		log.Warn("leaving database open while webhook workers are still running")
+	} else if s.database != nil {
+		if err := s.database.Close(); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Error("unable to close database service")
+			shutdownErr = err
+		}
+	}
+
+	if err := s.tracing.Shutdown(ctx); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("unable to flush traces")
+		shutdownErr = err
+	}
+	return shutdownErr
+}
+
+// stopWithin calls stop, giving up waiting for it when ctx ends.
+func stopWithin(ctx context.Context, stop func()) error {
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func seconds(value int64, fallback time.Duration) time.Duration {
+	if value > 0 {
+		return time.Duration(value) * time.Second
+	}
+	return fallback
+}
+
+// connectDatabase starts the database service, retrying with exponential
+// backoff until timeout passes or ctx ends. A zero timeout retries for as long
+// as ctx lasts.
+func connectDatabase(ctx context.Context, cfg *config.Config, timeout time.Duration) (*postgres.Service, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	delay := baseConnectDelay
+	for attempt := 1; ; attempt++ {
+		service, err := postgres.NewService(cfg)
+		if err == nil {
+			return service, nil
+		}
+		if err == config.ErrInvalidConfig {
+			return nil, err
+		}
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			return nil, err
+		}
+
+		log.WithFields(log.Fields{
+			"error":   err,
+			"attempt": attempt,
+			"retry":   delay.String(),
+		}).Warn("unable to connect to database, retrying")
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxConnectDelay {
+			delay = maxConnectDelay
+		}
+	}
+}
+
+func databaseStartupTimeout(cfg *config.Config) time.Duration {
+	if cfg.Databases == nil || cfg.Databases.Gamejam == nil {
+		return defaultStartupTimeout
+	}
+	return seconds(cfg.Databases.Gamejam.StartupTimeout, defaultStartupTimeout)
+}
+
+// requireDatabase answers 503 while the server is running without its
+// database, rather than letting handlers reach a nil service.
+func (s *Server) requireDatabase(c *gin.Context) {
+	if atomic.LoadInt32(&s.ready) == 0 {
+		c.Header("Retry-After", strconv.Itoa(int(maxConnectDelay/time.Second)))
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "database unavailable"})
+		return
+	}
+	c.Next()
+}
+
+// db is the database scoped to the request, so its queries are cancelled with
+// it and traced beneath it.
+func (s *Server) db(c *gin.Context) *postgres.Service {
+	return s.database.WithContext(c.Request.Context())
+}
@@ -0,0 +1,183 @@
+package rest
+
+import (
+	"database/sql"
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/notify"
+	"lemon/lemon-api/pkg/postgres"
+	"lemon/lemon-api/pkg/security"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	shareCodeLength    = 8
+	defaultShareExpiry = time.Hour * 24
+	maxShareExpiry     = time.Hour * 24 * 30
+)
+
+func (s *Server) ShareSave(c *gin.Context) {
+	accountID, ok := s.requireAccount(c)
+	if !ok {
+		return
+	}
+
+	game := activeGame(c)
+	if !game.SharingEnabled {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	var request lemon_api.ShareRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&request); err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Error("Failed to bind JSON")
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+	}
+
+	expiry := defaultShareExpiry
+	if request.ExpiresIn > 0 {
+		expiry = time.Duration(request.ExpiresIn) * time.Second
+	}
+	if expiry > maxShareExpiry {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "expires_in may not exceed " + strconv.Itoa(int(maxShareExpiry.Seconds())) + " seconds"})
+		return
+	}
+
+	save, err := s.db(c).GetSave(game.ID, accountID, c.Param("slot"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to get save from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	code, err := security.RandomCode(shareCodeLength)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to generate share code")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	expires := now.Add(expiry)
+	share := lemon_api.SaveShare{
+		Code:        code,
+		GameID:      game.ID,
+		AccountID:   accountID,
+		Slot:        save.Slot,
+		SaveState:   save.SaveState,
+		SaveVersion: save.SaveVersion,
+		SingleUse:   request.SingleUse,
+		Created:     &now,
+		Expires:     &expires,
+	}
+
+	if err := s.db(c).InsertSaveShare(share); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to insert save share")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, share)
+}
+
+// ImportSave copies a shared snapshot into one of the caller's slots, chosen
+// with the slot query parameter and defaulting to the default slot.
+func (s *Server) ImportSave(c *gin.Context) {
+	accountID, ok := s.requireAccount(c)
+	if !ok {
+		return
+	}
+
+	game := activeGame(c)
+	if !game.SharingEnabled {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	// Codes are issued in upper case; accept them however they're typed.
+	code := strings.ToUpper(strings.TrimSpace(c.Param("code")))
+	share, err := s.db(c).GetSaveShare(game.ID, code)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to get save share from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	save := lemon_api.Save{
+		GameID:      game.ID,
+		AccountID:   accountID,
+		Slot:        c.DefaultQuery("slot", lemon_api.DefaultSaveSlot),
+		SaveState:   share.SaveState,
+		SaveVersion: share.SaveVersion,
+	}
+	save.Signature = security.SignSave(s.config, save.AccountID, save.SaveState)
+
+	if err := s.db(c).RedeemSaveShare(code, save, notify.For(s.notifiers, lemon_api.WebhookEventSaveUpdated)); err != nil {
+		if err == postgres.ErrShareUnavailable {
+			c.AbortWithStatus(http.StatusGone)
+			return
+		}
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to redeem save share")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, save)
+}
+
+func (s *Server) GetSharingSettings(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, lemon_api.SharingSettings{Enabled: activeGame(c).SharingEnabled})
+}
+
+func (s *Server) UpdateSharingSettings(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	var settings lemon_api.SharingSettings
+	if err := c.BindJSON(&settings); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if err := s.db(c).UpdateGameSharing(activeGame(c).ID, settings.Enabled); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
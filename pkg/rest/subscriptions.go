@@ -0,0 +1,313 @@
+package rest
+
+import (
+	"database/sql"
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/security"
+	"lemon/lemon-api/pkg/webhook"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSecretGrace = 24 * time.Hour
+	maxSecretGrace     = 7 * 24 * time.Hour
+)
+
+// GetWebhookSubscriptions lists the game's subscriptions. Secrets are only
+// shown when they are created or rotated.
+func (s *Server) GetWebhookSubscriptions(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	subscriptions, err := s.db(c).GetWebhookSubscriptions(activeGame(c).ID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if subscriptions == nil {
+		subscriptions = []*lemon_api.WebhookSubscription{}
+	}
+	for _, subscription := range subscriptions {
+		subscription.Secret = ""
+	}
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+func (s *Server) GetWebhookSubscription(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	subscriptionID, ok := subscriptionIDParam(c)
+	if !ok {
+		return
+	}
+
+	subscription, ok := s.findSubscription(c, activeGame(c).ID, subscriptionID)
+	if !ok {
+		return
+	}
+	subscription.Secret = ""
+	c.JSON(http.StatusOK, subscription)
+}
+
+// NewWebhookSubscription registers a URL for some of the game's events. The
+// response holds the signing secret, which isn't shown again.
+func (s *Server) NewWebhookSubscription(c *gin.Context) {
+	user, ok := s.requireDeveloper(c)
+	if !ok {
+		return
+	}
+
+	var request lemon_api.WebhookSubscriptionRequest
+	if err := c.BindJSON(&request); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	subscription := lemon_api.WebhookSubscription{
+		GameID:    activeGame(c).ID,
+		URL:       request.URL,
+		Events:    request.Events,
+		Active:    request.Active == nil || *request.Active,
+		CreatedBy: &user.ID,
+	}
+	if !s.validateSubscription(c, &subscription) {
+		return
+	}
+
+	secret, err := security.NewWebhookSecret()
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	subscription.Secret = secret
+
+	subscriptionID, err := s.db(c).InsertWebhookSubscription(subscription)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	created, ok := s.findSubscription(c, subscription.GameID, subscriptionID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, created)
+}
+
+// UpdateWebhookSubscription changes a subscription's URL, events or whether it
+// is active. Fields left out of the request keep their value.
+func (s *Server) UpdateWebhookSubscription(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	subscriptionID, ok := subscriptionIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request lemon_api.WebhookSubscriptionRequest
+	if err := c.BindJSON(&request); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	subscription, ok := s.findSubscription(c, activeGame(c).ID, subscriptionID)
+	if !ok {
+		return
+	}
+	if request.URL != "" {
+		subscription.URL = request.URL
+	}
+	if request.Events != nil {
+		subscription.Events = request.Events
+	}
+	if request.Active != nil {
+		subscription.Active = *request.Active
+	}
+	if !s.validateSubscription(c, subscription) {
+		return
+	}
+
+	if err := s.db(c).UpdateWebhookSubscription(*subscription); err != nil {
+		if err == sql.ErrNoRows {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	subscription.Secret = ""
+	c.JSON(http.StatusOK, subscription)
+}
+
+// DeleteWebhookSubscription removes a subscription. Deliveries still queued
+// for it are dropped along with its delivery log.
+func (s *Server) DeleteWebhookSubscription(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	subscriptionID, ok := subscriptionIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := s.db(c).DeleteWebhookSubscription(activeGame(c).ID, subscriptionID); err != nil {
+		if err == sql.ErrNoRows {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.AbortWithStatus(http.StatusOK)
+}
+
+// RotateWebhookSecret gives a subscription a new secret. The old one keeps
+// signing deliveries alongside it for the grace period, in seconds, so the
+// receiver can switch over without dropping any.
+func (s *Server) RotateWebhookSecret(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	subscriptionID, ok := subscriptionIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request lemon_api.WebhookSecretRotationRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&request); err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Error("Failed to bind JSON")
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+	}
+
+	grace := defaultSecretGrace
+	if s.config.Webhooks != nil && s.config.Webhooks.SecretGrace > 0 {
+		grace = time.Duration(s.config.Webhooks.SecretGrace) * time.Second
+	}
+	if request.Grace != nil {
+		grace = time.Duration(*request.Grace) * time.Second
+		if grace < 0 || grace > maxSecretGrace {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "grace must be between 0 and " + strconv.Itoa(int(maxSecretGrace/time.Second)) + " seconds"})
+			return
+		}
+	}
+
+	secret, err := security.NewWebhookSecret()
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	subscription, err := s.db(c).RotateWebhookSubscriptionSecret(activeGame(c).ID, subscriptionID, secret, time.Now().UTC().Add(grace))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+// GetSubscriptionDeliveries lists recent deliveries to one subscription. It
+// takes the same status and limit filters as GetWebhookDeliveries.
+func (s *Server) GetSubscriptionDeliveries(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	subscriptionID, ok := subscriptionIDParam(c)
+	if !ok {
+		return
+	}
+
+	if _, ok := s.findSubscription(c, activeGame(c).ID, subscriptionID); !ok {
+		return
+	}
+
+	s.listWebhookDeliveries(c, &subscriptionID)
+}
+
+// validateSubscription checks the URL and events of a subscription about to
+// be saved, aborting with 400 if they won't do.
+func (s *Server) validateSubscription(c *gin.Context, subscription *lemon_api.WebhookSubscription) bool {
+	allowPrivate := s.config.Webhooks != nil && s.config.Webhooks.AllowPrivateURLs
+	if err := webhook.ValidateURL(subscription.URL, allowPrivate); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if len(subscription.Events) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "subscribe to at least one event", "events": lemon_api.WebhookEvents})
+		return false
+	}
+
+	seen := map[string]bool{}
+	var events lemon_api.WebhookEventList
+	for _, event := range subscription.Events {
+		if !lemon_api.IsWebhookEvent(event) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unknown event " + event, "events": lemon_api.WebhookEvents})
+			return false
+		}
+		if event == lemon_api.WebhookEventFeedbackDigest {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "digests are only sent to notifiers"})
+			return false
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	subscription.Events = events
+	return true
+}
+
+func subscriptionIDParam(c *gin.Context) (int64, bool) {
+	subscriptionID, err := strconv.ParseInt(c.Param("subscriptionID"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid subscription ID"})
+		return 0, false
+	}
+	return subscriptionID, true
+}
+
+// findSubscription loads a subscription in the active game, aborting with 404
+// if there is no such subscription.
+func (s *Server) findSubscription(c *gin.Context, gameID string, subscriptionID int64) (*lemon_api.WebhookSubscription, bool) {
+	subscription, err := s.db(c).GetWebhookSubscription(gameID, subscriptionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.AbortWithStatus(http.StatusNotFound)
+			return nil, false
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	return subscription, true
+}
@@ -0,0 +1,368 @@
+package rest
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/postgres"
+	"lemon/lemon-api/pkg/survey"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// surveyTransitions lists the statuses a survey may move to from each status.
+// Published surveys can be closed and reopened but never edited again.
+var surveyTransitions = map[string][]string{
+	lemon_api.SurveyStatusDraft:     {lemon_api.SurveyStatusPublished},
+	lemon_api.SurveyStatusPublished: {lemon_api.SurveyStatusClosed},
+	lemon_api.SurveyStatusClosed:    {lemon_api.SurveyStatusPublished},
+}
+
+func canTransitionSurvey(from string, to string) bool {
+	for _, status := range surveyTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSurveys lists the published surveys for the build named in the query.
+// Developers can pass all=true to include drafts and closed surveys.
+func (s *Server) GetSurveys(c *gin.Context) {
+	game := activeGame(c)
+
+	var surveys []*lemon_api.Survey
+	var err error
+	if c.Query("all") == "true" {
+		if _, ok := s.requireDeveloper(c); !ok {
+			return
+		}
+		surveys, err = s.db(c).GetSurveys(game.ID)
+	} else {
+		surveys, err = s.db(c).GetPublishedSurveys(game.ID, c.Query("build"))
+	}
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if surveys == nil {
+		surveys = []*lemon_api.Survey{}
+	}
+	c.JSON(http.StatusOK, surveys)
+}
+
+// GetSurvey returns a published survey to anyone, and drafts or closed
+// surveys to developers.
+func (s *Server) GetSurvey(c *gin.Context) {
+	surveyID, ok := surveyIDParam(c)
+	if !ok {
+		return
+	}
+
+	found, ok := s.findSurvey(c, activeGame(c).ID, surveyID)
+	if !ok {
+		return
+	}
+	if found.Status != lemon_api.SurveyStatusPublished {
+		if _, ok := s.requireDeveloper(c); !ok {
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, found)
+}
+
+// NewSurvey creates a draft survey from a developer's definition.
+func (s *Server) NewSurvey(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	newSurvey, ok := bindSurvey(c)
+	if !ok {
+		return
+	}
+	newSurvey.GameID = activeGame(c).ID
+	newSurvey.Status = lemon_api.SurveyStatusDraft
+
+	surveyID, err := s.db(c).InsertSurvey(*newSurvey)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	newSurvey.ID = surveyID
+	c.JSON(http.StatusOK, newSurvey)
+}
+
+// UpdateSurvey replaces the definition of a draft survey.
+func (s *Server) UpdateSurvey(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	surveyID, ok := surveyIDParam(c)
+	if !ok {
+		return
+	}
+
+	updated, ok := bindSurvey(c)
+	if !ok {
+		return
+	}
+	updated.ID = surveyID
+	updated.GameID = activeGame(c).ID
+
+	if _, ok := s.findSurvey(c, updated.GameID, surveyID); !ok {
+		return
+	}
+
+	if err := s.db(c).UpdateSurvey(*updated); err != nil {
+		if err == postgres.ErrSurveyNotDraft {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.AbortWithStatus(http.StatusOK)
+}
+
+// UpdateSurveyStatus publishes, closes or reopens a survey.
+func (s *Server) UpdateSurveyStatus(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	surveyID, ok := surveyIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request lemon_api.SurveyStatusRequest
+	if err := c.BindJSON(&request); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	gameID := activeGame(c).ID
+	found, ok := s.findSurvey(c, gameID, surveyID)
+	if !ok {
+		return
+	}
+
+	if !canTransitionSurvey(found.Status, request.Status) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("cannot move survey from %s to %s", found.Status, request.Status),
+		})
+		return
+	}
+
+	if err := s.db(c).UpdateSurveyStatus(gameID, surveyID, request.Status); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.AbortWithStatus(http.StatusOK)
+}
+
+// SubmitSurveyResponse records a player's answers to a published survey after
+// checking them against its questions.
+func (s *Server) SubmitSurveyResponse(c *gin.Context) {
+	surveyID, ok := surveyIDParam(c)
+	if !ok {
+		return
+	}
+
+	var response lemon_api.SurveyResponse
+	if err := c.BindJSON(&response); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	accountID, ok := s.optionalAccount(c)
+	if !ok {
+		return
+	}
+
+	found, ok := s.findSurvey(c, activeGame(c).ID, surveyID)
+	if !ok {
+		return
+	}
+	if found.Status != lemon_api.SurveyStatusPublished {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "survey is not accepting responses"})
+		return
+	}
+	if found.Build != "" {
+		if response.Build != "" && response.Build != found.Build {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "survey is not published for this build"})
+			return
+		}
+		response.Build = found.Build
+	}
+
+	if err := survey.ValidateAnswers(found.Questions, response.Answers); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response.SurveyID = surveyID
+	response.AccountID = accountID
+	responseID, err := s.db(c).InsertSurveyResponse(response)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": responseID})
+}
+
+// GetSurveyResults aggregates the responses to a survey per question, as JSON
+// or, with format=csv, as one row per question and answer. Pass build to only
+// count responses from one build.
+func (s *Server) GetSurveyResults(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	surveyID, ok := surveyIDParam(c)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+
+	gameID := activeGame(c).ID
+	found, ok := s.findSurvey(c, gameID, surveyID)
+	if !ok {
+		return
+	}
+
+	responses, answered, counts, err := s.db(c).GetSurveyAnswerCounts(gameID, surveyID, c.Query("build"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	results := survey.Aggregate(found, responses, answered, counts)
+
+	if format == "json" {
+		c.JSON(http.StatusOK, results)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=survey-%d-results.csv", surveyID))
+	c.Status(http.StatusOK)
+	c.Writer.Header().Set("Content-Type", "text/csv")
+	if err := writeSurveyResultsCSV(c.Writer, results); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to write survey results")
+	}
+}
+
+func writeSurveyResultsCSV(w http.ResponseWriter, results *lemon_api.SurveyResults) error {
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"question_id", "type", "prompt", "answered", "average", "answer", "count"}); err != nil {
+		return err
+	}
+
+	for _, question := range results.Questions {
+		average := ""
+		if question.Average != nil {
+			average = strconv.FormatFloat(*question.Average, 'f', 2, 64)
+		}
+		row := []string{question.ID, question.Type, question.Prompt, strconv.FormatInt(question.Answered, 10), average}
+
+		if question.Type == lemon_api.SurveyQuestionText {
+			for _, answer := range question.Answers {
+				if err := out.Write(append(row, answer, "")); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		answers := make([]string, 0, len(question.Counts))
+		for answer := range question.Counts {
+			answers = append(answers, answer)
+		}
+		sort.Strings(answers)
+		for _, answer := range answers {
+			if err := out.Write(append(row, answer, strconv.FormatInt(question.Counts[answer], 10))); err != nil {
+				return err
+			}
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func bindSurvey(c *gin.Context) (*lemon_api.Survey, bool) {
+	var definition lemon_api.Survey
+	if err := c.BindJSON(&definition); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return nil, false
+	}
+
+	if strings.TrimSpace(definition.Title) == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing title"})
+		return nil, false
+	}
+
+	if err := survey.ValidateDefinition(definition.Questions); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return &definition, true
+}
+
+func surveyIDParam(c *gin.Context) (int64, bool) {
+	surveyID, err := strconv.ParseInt(c.Param("surveyID"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid survey ID"})
+		return 0, false
+	}
+	return surveyID, true
+}
+
+// findSurvey loads a survey in the active game, aborting with 404 if there is
+// no such survey.
+func (s *Server) findSurvey(c *gin.Context, gameID string, surveyID int64) (*lemon_api.Survey, bool) {
+	found, err := s.db(c).GetSurvey(gameID, surveyID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.AbortWithStatus(http.StatusNotFound)
+			return nil, false
+		}
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to get survey")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	return found, true
+}
@@ -0,0 +1,241 @@
+package rest
+
+import (
+	"database/sql"
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/notify"
+	"lemon/lemon-api/pkg/postgres"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+func (s *Server) UpdateFeedbackStatus(c *gin.Context) {
+	user, ok := s.requireDeveloper(c)
+	if !ok {
+		return
+	}
+
+	feedbackID, ok := feedbackIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request lemon_api.FeedbackStatusRequest
+	if err := c.BindJSON(&request); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	game := activeGame(c)
+	feedback, ok := s.findFeedback(c, game.ID, feedbackID)
+	if !ok {
+		return
+	}
+
+	if _, known := lemon_api.FeedbackTransitions[request.Status]; !known {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unknown status " + request.Status})
+		return
+	}
+
+	if !lemon_api.CanTransitionFeedback(feedback.Status, request.Status) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error":   "feedback can't move from " + feedback.Status + " to " + request.Status,
+			"allowed": lemon_api.FeedbackTransitions[feedback.Status],
+		})
+		return
+	}
+
+	var duplicateOf *int64
+	if request.Status == lemon_api.FeedbackStatusDuplicate {
+		if request.DuplicateOf == nil || *request.DuplicateOf == feedbackID {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "duplicate_of must name another feedback item"})
+			return
+		}
+
+		canonical, ok := s.findFeedback(c, game.ID, *request.DuplicateOf)
+		if !ok {
+			return
+		}
+
+		// Link straight to the canonical item rather than building chains.
+		duplicateOf = &canonical.ID
+		if canonical.DuplicateOf != nil {
+			duplicateOf = canonical.DuplicateOf
+		}
+		if *duplicateOf == feedbackID {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "feedback can't be a duplicate of its own duplicate"})
+			return
+		}
+	}
+
+	err := s.db(c).UpdateFeedbackStatus(game.ID, feedbackID, feedback.Status, request.Status, duplicateOf, user.ID, notify.For(s.notifiers, lemon_api.WebhookEventFeedbackStatusChanged))
+	if err != nil {
+		if err == postgres.ErrStatusChanged {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to update feedback status")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	feedback.Status = request.Status
+	feedback.DuplicateOf = duplicateOf
+	c.JSON(http.StatusOK, feedback)
+}
+
+func (s *Server) AssignFeedback(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	feedbackID, ok := feedbackIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request lemon_api.FeedbackAssignRequest
+	if err := c.BindJSON(&request); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	game := activeGame(c)
+	feedback, ok := s.findFeedback(c, game.ID, feedbackID)
+	if !ok {
+		return
+	}
+
+	var assigneeID *string
+	if request.AssigneeID != "" {
+		isDeveloper, err := s.db(c).IsGameDeveloper(game.ID, request.AssigneeID)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !isDeveloper {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "feedback can only be assigned to a developer of this game"})
+			return
+		}
+		assigneeID = &request.AssigneeID
+	}
+
+	if err := s.db(c).AssignFeedback(game.ID, feedbackID, assigneeID); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	feedback.AssigneeID = assigneeID
+	c.JSON(http.StatusOK, feedback)
+}
+
+func (s *Server) GetFeedbackHistory(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	feedbackID, ok := feedbackIDParam(c)
+	if !ok {
+		return
+	}
+
+	history, err := s.db(c).GetFeedbackHistory(activeGame(c).ID, feedbackID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if history == nil {
+		history = []*lemon_api.FeedbackStatusChange{}
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+func (s *Server) GetFeedbackNotes(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	feedbackID, ok := feedbackIDParam(c)
+	if !ok {
+		return
+	}
+
+	notes, err := s.db(c).GetFeedbackNotes(activeGame(c).ID, feedbackID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if notes == nil {
+		notes = []*lemon_api.FeedbackNote{}
+	}
+	c.JSON(http.StatusOK, notes)
+}
+
+func (s *Server) AddFeedbackNote(c *gin.Context) {
+	user, ok := s.requireDeveloper(c)
+	if !ok {
+		return
+	}
+
+	feedbackID, ok := feedbackIDParam(c)
+	if !ok {
+		return
+	}
+
+	var note lemon_api.FeedbackNote
+	if err := c.BindJSON(&note); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(note.Body) == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note body is empty"})
+		return
+	}
+
+	if _, ok := s.findFeedback(c, activeGame(c).ID, feedbackID); !ok {
+		return
+	}
+
+	note.FeedbackID = feedbackID
+	note.AuthorID = &user.ID
+	note.Author = user.Username
+
+	noteID, err := s.db(c).InsertFeedbackNote(note)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	note.ID = noteID
+	c.JSON(http.StatusOK, note)
+}
+
+// findFeedback loads feedback in the active game, aborting with 404 if there
+// is no such item.
+func (s *Server) findFeedback(c *gin.Context, gameID string, feedbackID int64) (*lemon_api.Feedback, bool) {
+	feedback, err := s.db(c).GetFeedbackByID(gameID, feedbackID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.AbortWithStatus(http.StatusNotFound)
+			return nil, false
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	return feedback, true
+}
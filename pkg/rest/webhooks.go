@@ -0,0 +1,173 @@
+package rest
+
+import (
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/config"
+	"lemon/lemon-api/pkg/notify"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 200
+)
+
+// GetWebhookDeliveries lists the game's recent webhook deliveries, newest
+// first. Pass status=dead to see the ones that gave up.
+func (s *Server) GetWebhookDeliveries(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	s.listWebhookDeliveries(c, nil)
+}
+
+// listWebhookDeliveries answers with the active game's deliveries, only those
+// to one subscription if subscriptionID is set.
+func (s *Server) listWebhookDeliveries(c *gin.Context, subscriptionID *int64) {
+	status := c.Query("status")
+	switch status {
+	case "", lemon_api.WebhookStatusPending, lemon_api.WebhookStatusDelivered, lemon_api.WebhookStatusDead:
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unknown status " + status})
+		return
+	}
+
+	limit := defaultDeliveryLimit
+	if value := c.Query("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		if limit > maxDeliveryLimit {
+			limit = maxDeliveryLimit
+		}
+	}
+
+	deliveries, err := s.db(c).GetWebhookDeliveries(activeGame(c).ID, subscriptionID, status, limit)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*lemon_api.WebhookDelivery{}
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// ReplayWebhookDelivery queues a dead lettered or delivered webhook to be
+// sent again with a fresh set of attempts.
+func (s *Server) ReplayWebhookDelivery(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	deliveryID, ok := deliveryIDParam(c)
+	if !ok {
+		return
+	}
+
+	replayed, err := s.db(c).ReplayWebhookDelivery(activeGame(c).ID, deliveryID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !replayed {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "no finished delivery with that ID"})
+		return
+	}
+
+	c.AbortWithStatus(http.StatusOK)
+}
+
+// GetWebhookAttempts is a delivery's log: every attempt at sending it, with
+// the status it got back and how long it took.
+func (s *Server) GetWebhookAttempts(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	deliveryID, ok := deliveryIDParam(c)
+	if !ok {
+		return
+	}
+
+	attempts, err := s.db(c).GetWebhookAttempts(activeGame(c).ID, deliveryID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if attempts == nil {
+		attempts = []*lemon_api.WebhookAttempt{}
+	}
+	c.JSON(http.StatusOK, attempts)
+}
+
+// PreviewWebhookTemplate renders a notification against sample data, or data
+// the caller sends, without delivering it. Template errors come back as 400s
+// so they can be fixed before the config is changed.
+func (s *Server) PreviewWebhookTemplate(c *gin.Context) {
+	if _, ok := s.requireDeveloper(c); !ok {
+		return
+	}
+
+	var request lemon_api.TemplatePreviewRequest
+	if err := c.BindJSON(&request); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Failed to bind JSON")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := notify.Sample(request.Event, *activeGame(c))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(request.Data) > 0 {
+		delivery.Payload = request.Data
+	}
+
+	templated := request.Title != "" || request.Text != "" || request.URL != ""
+	if templated && request.Notifier != "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "give either a notifier or templates, not both"})
+		return
+	}
+
+	var message notify.Message
+	if request.Notifier != "" {
+		notifier, ok := s.notifiers[request.Notifier]
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown notifier " + request.Notifier})
+			return
+		}
+		message, err = notifier.Render(delivery)
+	} else {
+		message, err = notify.RenderTemplate(s.config.Webhooks, config.MessageTemplate{
+			Title: request.Title,
+			Text:  request.Text,
+			URL:   request.URL,
+		}, delivery)
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+func deliveryIDParam(c *gin.Context) (int64, bool) {
+	deliveryID, err := strconv.ParseInt(c.Param("deliveryID"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid delivery ID"})
+		return 0, false
+	}
+	return deliveryID, true
+}
@@ -0,0 +1,227 @@
+package savestate
+
+import (
+	"encoding/json"
+	"strings"
+
+	lemon_api "lemon/lemon-api"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrUnknownMigrationKind = errors.New("unknown migration kind")
+	ErrInvalidMigration     = errors.New("invalid migration")
+	ErrNoMigrationPath      = errors.New("no migration path between save versions")
+)
+
+// Migration upgrades a save state written by one build into the format
+// expected by the next.
+type Migration interface {
+	Apply(saveState string) (string, error)
+}
+
+// MigrationFactory builds a Migration from the definition a developer stored.
+type MigrationFactory func(definition json.RawMessage) (Migration, error)
+
+// TransformKind is the built in declarative migration and the default when a
+// stored migration doesn't name a kind.
+const TransformKind = "transform"
+
+var factories = map[string]MigrationFactory{
+	TransformKind: NewTransform,
+}
+
+// RegisterMigrationKind makes a custom migration implementation available to
+// stored migrations. It is not safe to call once the server is running.
+func RegisterMigrationKind(kind string, factory MigrationFactory) {
+	factories[kind] = factory
+}
+
+func NewMigration(kind string, definition json.RawMessage) (Migration, error) {
+	if kind == "" {
+		kind = TransformKind
+	}
+
+	factory, ok := factories[kind]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownMigrationKind, kind)
+	}
+
+	return factory(definition)
+}
+
+// Upgrade walks the registered migrations from one save version to another,
+// applying each step in turn.
+func Upgrade(migrations []*lemon_api.SaveMigration, from string, to string, saveState string) (string, error) {
+	steps := make(map[string]*lemon_api.SaveMigration, len(migrations))
+	for _, migration := range migrations {
+		steps[migration.FromVersion] = migration
+	}
+
+	visited := map[string]bool{}
+	for version := from; version != to; {
+		if visited[version] {
+			return "", errors.Wrap(ErrNoMigrationPath, "migration chain loops at "+version)
+		}
+		visited[version] = true
+
+		step, ok := steps[version]
+		if !ok {
+			return "", errors.Wrap(ErrNoMigrationPath, from+" to "+to)
+		}
+
+		migration, err := NewMigration(step.Kind, step.Definition)
+		if err != nil {
+			return "", err
+		}
+
+		saveState, err = migration.Apply(saveState)
+		if err != nil {
+			return "", errors.Wrapf(err, "migrating %v to %v", step.FromVersion, step.ToVersion)
+		}
+
+		version = step.ToVersion
+	}
+
+	return saveState, nil
+}
+
+// Operation is a single step of a Transform. Paths are dot separated keys into
+// nested objects, e.g. "player.stats.hp".
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Transform is a declarative migration made up of set, default, remove,
+// rename and copy operations applied in order to a JSON object save.
+type Transform struct {
+	Operations []Operation `json:"operations"`
+}
+
+func NewTransform(definition json.RawMessage) (Migration, error) {
+	var transform Transform
+	if err := json.Unmarshal(definition, &transform); err != nil {
+		return nil, errors.Wrap(ErrInvalidMigration, err.Error())
+	}
+
+	for _, op := range transform.Operations {
+		if op.Path == "" {
+			return nil, errors.Wrap(ErrInvalidMigration, "operation "+op.Op+" missing path")
+		}
+		switch op.Op {
+		case "set", "default":
+			if len(op.Value) == 0 {
+				return nil, errors.Wrap(ErrInvalidMigration, "operation "+op.Op+" missing value")
+			}
+		case "rename", "copy":
+			if op.From == "" {
+				return nil, errors.Wrap(ErrInvalidMigration, "operation "+op.Op+" missing from")
+			}
+		case "remove":
+		default:
+			return nil, errors.Wrap(ErrInvalidMigration, "unknown operation "+op.Op)
+		}
+	}
+
+	return &transform, nil
+}
+
+func (t *Transform) Apply(saveState string) (string, error) {
+	// A null save state decodes without error into a nil map, which is no
+	// more an object than an array or a number.
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(saveState), &doc); err != nil || doc == nil {
+		return "", errors.Wrap(ErrInvalidMigration, "save state is not a JSON object")
+	}
+
+	for _, op := range t.Operations {
+		switch op.Op {
+		case "set", "default":
+			if op.Op == "default" {
+				if _, ok := lookup(doc, op.Path); ok {
+					continue
+				}
+			}
+			var value interface{}
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return "", errors.Wrap(ErrInvalidMigration, err.Error())
+			}
+			if err := assign(doc, op.Path, value); err != nil {
+				return "", err
+			}
+		case "remove":
+			remove(doc, op.Path)
+		case "rename", "copy":
+			value, ok := lookup(doc, op.From)
+			if !ok {
+				continue
+			}
+			if err := assign(doc, op.Path, value); err != nil {
+				return "", err
+			}
+			if op.Op == "rename" {
+				remove(doc, op.From)
+			}
+		}
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func lookup(doc map[string]interface{}, path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	current := doc
+	for i, key := range keys {
+		value, ok := current[key]
+		if !ok {
+			return nil, false
+		}
+		if i == len(keys)-1 {
+			return value, true
+		}
+		if current, ok = value.(map[string]interface{}); !ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+func assign(doc map[string]interface{}, path string, value interface{}) error {
+	keys := strings.Split(path, ".")
+	current := doc
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key]
+		if !ok {
+			child := map[string]interface{}{}
+			current[key] = child
+			current = child
+			continue
+		}
+		if current, ok = next.(map[string]interface{}); !ok {
+			return errors.Wrap(ErrInvalidMigration, path+" passes through a non-object value")
+		}
+	}
+	current[keys[len(keys)-1]] = value
+	return nil
+}
+
+func remove(doc map[string]interface{}, path string) {
+	keys := strings.Split(path, ".")
+	current := doc
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		current = next
+	}
+	delete(current, keys[len(keys)-1])
+}
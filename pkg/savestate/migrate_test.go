@@ -0,0 +1,38 @@
+package savestate
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func newTestTransform(t *testing.T) Migration {
+	migration, err := NewTransform(json.RawMessage(`{"operations": [
+		{"op": "set", "path": "player.level", "value": 2},
+		{"op": "rename", "from": "gold", "path": "player.gold"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migration
+}
+
+func TestTransformApply(t *testing.T) {
+	got, err := newTestTransform(t).Apply(`{"gold": 10}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"player":{"gold":10,"level":2}}`; got != want {
+		t.Fatalf("Apply = %s, want %s", got, want)
+	}
+}
+
+func TestTransformApplyNonObject(t *testing.T) {
+	for _, saveState := range []string{`null`, `[]`, `[{"gold": 10}]`, `"save"`, `10`, `true`, ``} {
+		_, err := newTestTransform(t).Apply(saveState)
+		if errors.Cause(err) != ErrInvalidMigration {
+			t.Errorf("Apply(%q) returned %v, want ErrInvalidMigration", saveState, err)
+		}
+	}
+}
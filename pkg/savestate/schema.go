@@ -0,0 +1,41 @@
+package savestate
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+var (
+	ErrInvalidSchema = errors.New("invalid save schema")
+	ErrInvalidSave   = errors.New("save does not match schema")
+)
+
+// CompileSchema checks that a JSON Schema document can be loaded before it is
+// stored against a build version.
+func CompileSchema(schema []byte) error {
+	if _, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schema)); err != nil {
+		return errors.Wrap(ErrInvalidSchema, err.Error())
+	}
+	return nil
+}
+
+// Validate checks a save state against the JSON Schema registered for its
+// build version. The returned error lists every violation found.
+func Validate(schema []byte, saveState string) error {
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(schema), gojsonschema.NewStringLoader(saveState))
+	if err != nil {
+		return errors.Wrap(ErrInvalidSave, err.Error())
+	}
+
+	if !result.Valid() {
+		violations := make([]string, 0, len(result.Errors()))
+		for _, violation := range result.Errors() {
+			violations = append(violations, violation.String())
+		}
+		return errors.Wrap(ErrInvalidSave, strings.Join(violations, "; "))
+	}
+
+	return nil
+}
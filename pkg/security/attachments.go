@@ -0,0 +1,49 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"lemon/lemon-api/pkg/config"
+)
+
+var (
+	ErrExpiredAttachmentURL = errors.New("attachment url expired")
+	ErrInvalidAttachmentURL = errors.New("invalid attachment url")
+)
+
+// SignAttachment returns the signature for a download URL that grants access
+// to one attachment until the expiry, so developers can open it in a browser
+// without sending their token.
+func SignAttachment(cfg *config.Config, gameID string, attachmentID int64, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(cfg.Security.Secret))
+	mac.Write([]byte("attachment"))
+	mac.Write([]byte{0})
+	mac.Write([]byte(gameID))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.FormatInt(attachmentID, 10)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func VerifyAttachment(cfg *config.Config, gameID string, attachmentID int64, expires int64, signature string) error {
+	provided, err := hex.DecodeString(signature)
+	if err != nil || signature == "" {
+		return ErrInvalidAttachmentURL
+	}
+
+	expected, _ := hex.DecodeString(SignAttachment(cfg, gameID, attachmentID, expires))
+	if !hmac.Equal(provided, expected) {
+		return ErrInvalidAttachmentURL
+	}
+
+	if time.Now().Unix() > expires {
+		return ErrExpiredAttachmentURL
+	}
+	return nil
+}
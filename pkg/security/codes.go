@@ -0,0 +1,46 @@
+package security
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+)
+
+// codeAlphabet leaves out characters that are easy to misread when a code is
+// typed in by hand, such as 0/O and 1/I.
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// RandomCode returns a cryptographically random code of the given length for
+// players to read out or type on another device.
+func RandomCode(length int) (string, error) {
+	code := make([]byte, length)
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = codeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// NewAPIKey returns a random key games embed in their client to identify
+// themselves to the API.
+func NewAPIKey() (string, error) {
+	key := make([]byte, 24)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// NewWebhookSecret returns a random secret for signing deliveries to a webhook
+// subscription.
+func NewWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,52 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"lemon/lemon-api/pkg/config"
+)
+
+var (
+	ErrMissingSaveSignature = errors.New("missing save signature")
+	ErrInvalidSaveSignature = errors.New("invalid save signature")
+)
+
+// SignSave returns the hex encoded HMAC-SHA256 of a save state, bound to the
+// account it belongs to so a signed save can't be replayed onto another account.
+func SignSave(cfg *config.Config, accountID string, saveState string) string {
+	mac := hmac.New(sha256.New, saveKey(cfg))
+	mac.Write([]byte(accountID))
+	mac.Write([]byte{0})
+	mac.Write([]byte(saveState))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func VerifySave(cfg *config.Config, accountID string, saveState string, signature string) error {
+	if signature == "" {
+		return ErrMissingSaveSignature
+	}
+
+	provided, err := hex.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSaveSignature
+	}
+
+	expected, _ := hex.DecodeString(SignSave(cfg, accountID, saveState))
+	if !hmac.Equal(provided, expected) {
+		return ErrInvalidSaveSignature
+	}
+
+	return nil
+}
+
+// saveKey falls back to the token secret for deployments that haven't set a
+// dedicated save key yet.
+func saveKey(cfg *config.Config) []byte {
+	if cfg.Security.SaveKey != "" {
+		return []byte(cfg.Security.SaveKey)
+	}
+	return []byte(cfg.Security.Secret)
+}
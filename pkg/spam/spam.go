@@ -0,0 +1,192 @@
+package spam
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/config"
+
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidPattern = errors.New("invalid block pattern")
+
+const (
+	defaultMaxLinks           = 3
+	defaultDuplicateThreshold = 0.9
+	defaultDuplicateWindow    = time.Hour
+
+	// minDuplicateLength stops short descriptions like "great game" from
+	// matching every other player who said the same thing.
+	minDuplicateLength = 20
+	maxRepeatedRun     = 20
+)
+
+// Checker screens incoming feedback for spam before it is stored.
+type Checker struct {
+	blocklist []string
+	patterns  []*regexp.Regexp
+	maxLinks  int
+	threshold float64
+	window    time.Duration
+}
+
+// NewChecker builds a checker from the spam config, failing if a block
+// pattern doesn't compile. A nil config uses the defaults.
+func NewChecker(cfg *config.SpamConfig) (*Checker, error) {
+	checker := &Checker{
+		maxLinks:  defaultMaxLinks,
+		threshold: defaultDuplicateThreshold,
+		window:    defaultDuplicateWindow,
+	}
+	if cfg == nil {
+		return checker, nil
+	}
+
+	for _, term := range cfg.Blocklist {
+		if term = Normalize(term); term != "" {
+			checker.blocklist = append(checker.blocklist, term)
+		}
+	}
+	for _, pattern := range cfg.BlockPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidPattern, err.Error())
+		}
+		checker.patterns = append(checker.patterns, re)
+	}
+	if cfg.MaxLinks > 0 {
+		checker.maxLinks = cfg.MaxLinks
+	}
+	if cfg.DuplicateThreshold > 0 {
+		checker.threshold = cfg.DuplicateThreshold
+	}
+	if cfg.DuplicateWindow > 0 {
+		checker.window = time.Duration(cfg.DuplicateWindow) * time.Minute
+	}
+
+	return checker, nil
+}
+
+// Window is how far back to look for duplicates of new feedback.
+func (c *Checker) Window() time.Duration {
+	return c.window
+}
+
+// Check returns why feedback looks like spam, or "" if it doesn't.
+func (c *Checker) Check(feedback *lemon_api.Feedback) string {
+	if feedback.Website != "" {
+		return "honeypot field filled in"
+	}
+
+	normalized := Normalize(feedback.Description)
+	for _, term := range c.blocklist {
+		if strings.Contains(normalized, term) {
+			return "blocked term"
+		}
+	}
+	for _, re := range c.patterns {
+		if re.MatchString(feedback.Description) {
+			return "blocked pattern"
+		}
+	}
+
+	if links := countLinks(feedback.Description); links > c.maxLinks {
+		return "too many links (" + strconv.Itoa(links) + ")"
+	}
+	if longestRun(feedback.Description) >= maxRepeatedRun {
+		return "repeated characters"
+	}
+
+	return ""
+}
+
+// DuplicateOf finds recent feedback whose description is nearly the same as
+// the new description, returning its ID.
+func (c *Checker) DuplicateOf(description string, recent []*lemon_api.Feedback) (int64, bool) {
+	normalized := Normalize(description)
+	if len(normalized) < minDuplicateLength {
+		return 0, false
+	}
+
+	grams := trigrams(normalized)
+	for _, other := range recent {
+		if Similarity(grams, trigrams(Normalize(other.Description))) >= c.threshold {
+			if other.DuplicateOf != nil {
+				return *other.DuplicateOf, true
+			}
+			return other.ID, true
+		}
+	}
+	return 0, false
+}
+
+// Normalize lowercases text and reduces it to letters and digits separated
+// by single spaces, so punctuation and spacing don't hide a duplicate.
+func Normalize(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		} else {
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// Similarity is the Jaccard index of two sets of trigrams, from 0 for nothing
+// in common to 1 for the same text.
+func Similarity(a map[string]bool, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for gram := range a {
+		if b[gram] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func trigrams(text string) map[string]bool {
+	runes := []rune(text)
+	grams := make(map[string]bool, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		grams[string(runes[i:i+3])] = true
+	}
+	return grams
+}
+
+func countLinks(text string) int {
+	lower := strings.ToLower(text)
+	return strings.Count(lower, "http://") + strings.Count(lower, "https://") + strings.Count(lower, "www.") -
+		strings.Count(lower, "://www.")
+}
+
+func longestRun(text string) int {
+	longest, run := 0, 0
+	var last rune
+	for i, r := range text {
+		if i > 0 && r == last {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+		last = r
+	}
+	return longest
+}
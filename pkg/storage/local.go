@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps blobs as files under a root directory.
+type LocalStore struct {
+	root string
+}
+
+func NewLocalStore(root string) (*LocalStore, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{root: root}, nil
+}
+
+// Put writes to a temporary file first so a failed upload never leaves a
+// partial blob behind under its key.
+func (l *LocalStore) Put(key string, contentType string, size int64, body io.Reader) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (l *LocalStore) Get(key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *LocalStore) Delete(key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// path maps a key onto the filesystem, refusing absolute keys, as S3Store
+// does, and keys that would escape the root directory.
+func (l *LocalStore) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	path := filepath.Join(l.root, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, l.root+string(filepath.Separator)) {
+		return "", ErrInvalidKey
+	}
+	return path, nil
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestLocalStore(t *testing.T) (*LocalStore, func()) {
+	dir, err := ioutil.TempDir("", "lemon-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := func() { os.RemoveAll(dir) }
+
+	store, err := NewLocalStore(filepath.Join(dir, "root"))
+	if err != nil {
+		done()
+		t.Fatal(err)
+	}
+	return store, done
+}
+
+func TestLocalStorePath(t *testing.T) {
+	store, done := newTestLocalStore(t)
+	defer done()
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "games/1/feedback/a", want: "games/1/feedback/a"},
+		{key: "games/../a", want: "a"},
+		{key: ""},
+		{key: "../x"},
+		{key: "games/../../x"},
+		{key: ".."},
+		{key: "/x"},
+		{key: "/etc/passwd"},
+		{key: `games\..\..\x`},
+	}
+	for _, test := range tests {
+		path, err := store.path(test.key)
+		if test.want == "" {
+			if err != ErrInvalidKey {
+				t.Errorf("path(%q) = %q, %v; want ErrInvalidKey", test.key, path, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("path(%q) returned %v", test.key, err)
+			continue
+		}
+		if want := filepath.Join(store.root, filepath.FromSlash(test.want)); path != want {
+			t.Errorf("path(%q) = %q, want %q", test.key, path, want)
+		}
+	}
+}
+
+func TestLocalStorePutGetDelete(t *testing.T) {
+	store, done := newTestLocalStore(t)
+	defer done()
+
+	body := "screenshot"
+	if err := store.Put("games/1/feedback/a", "image/png", int64(len(body)), strings.NewReader(body)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	r, err := store.Get("games/1/feedback/a")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(got) != body {
+		t.Fatalf("Get returned %q, want %q", got, body)
+	}
+
+	if err := store.Delete("games/1/feedback/a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get("games/1/feedback/a"); err != ErrNotFound {
+		t.Fatalf("Get after Delete returned %v, want ErrNotFound", err)
+	}
+	if err := store.Put("../escape", "text/plain", 1, strings.NewReader("x")); err != ErrInvalidKey {
+		t.Fatalf("Put outside the root returned %v, want ErrInvalidKey", err)
+	}
+}
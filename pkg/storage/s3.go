@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"lemon/lemon-api/pkg/config"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// S3Store keeps blobs in a bucket on any S3 compatible service, such as AWS S3
+// or a local MinIO. Requests use path style addressing and are signed with
+// AWS Signature Version 4.
+type S3Store struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func NewS3Store(cfg *config.StorageConfig) (*S3Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 storage needs an endpoint and bucket")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region = defaultS3Region
+	}
+
+	return &S3Store{
+		endpoint:  endpoint,
+		region:    region,
+		bucket:    cfg.Bucket,
+		accessKey: cfg.AccessKey,
+		secretKey: cfg.SecretKey,
+		client:    &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+func (s *S3Store) Put(key string, contentType string, size int64, body io.Reader) error {
+	req, err := s.request(http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3Store) Get(key string) (io.ReadCloser, error) {
+	req, err := s.request(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) Delete(key string) error {
+	req, err := s.request(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3Store) request(method string, key string, body io.Reader) (*http.Request, error) {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return nil, ErrInvalidKey
+	}
+
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + key
+	u.RawPath = ""
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, time.Now().UTC())
+	return req, nil
+}
+
+// do sends a signed request, turning error responses into errors so callers
+// only ever see a successful body.
+func (s *S3Store) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(message)))
+}
+
+// sign adds a Signature Version 4 Authorization header. Payloads are sent
+// unsigned so uploads can be streamed without hashing them up front.
+func (s *S3Store) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + unsignedPayload + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"lemon/lemon-api/pkg/config"
+)
+
+// fakeS3 is a stand-in for an S3 bucket, keeping objects in memory by path.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]string
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") ||
+		r.Header.Get("X-Amz-Date") == "" ||
+		r.Header.Get("X-Amz-Content-Sha256") != unsignedPayload {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		b, _ := ioutil.ReadAll(r.Body)
+		f.objects[r.URL.Path] = string(b)
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		object, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(object))
+	case http.MethodDelete:
+		if _, ok := f.objects[r.URL.Path]; !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newFakeS3Store(t *testing.T) (*S3Store, *fakeS3, func()) {
+	fake := &fakeS3{objects: map[string]string{}, types: map[string]string{}}
+	server := httptest.NewServer(fake)
+
+	store, err := NewS3Store(&config.StorageConfig{
+		Endpoint:  server.URL,
+		Bucket:    "lemon",
+		AccessKey: "access",
+		SecretKey: "secret",
+	})
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return store, fake, server.Close
+}
+
+func TestS3StorePutGetDelete(t *testing.T) {
+	store, fake, done := newFakeS3Store(t)
+	defer done()
+
+	body := "player.log contents"
+	if err := store.Put("games/1/feedback/a", "text/plain", int64(len(body)), strings.NewReader(body)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got := fake.objects["/lemon/games/1/feedback/a"]; got != body {
+		t.Fatalf("stored %q, want %q under the bucket path", got, body)
+	}
+	if got := fake.types["/lemon/games/1/feedback/a"]; got != "text/plain" {
+		t.Fatalf("stored content type %q, want text/plain", got)
+	}
+
+	r, err := store.Get("games/1/feedback/a")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(got) != body {
+		t.Fatalf("Get returned %q, want %q", got, body)
+	}
+
+	if err := store.Delete("games/1/feedback/a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get("games/1/feedback/a"); err != ErrNotFound {
+		t.Fatalf("Get after Delete returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3StoreNotFound(t *testing.T) {
+	store, _, done := newFakeS3Store(t)
+	defer done()
+
+	if _, err := store.Get("missing"); err != ErrNotFound {
+		t.Fatalf("Get returned %v, want ErrNotFound", err)
+	}
+	if err := store.Delete("missing"); err != nil {
+		t.Fatalf("Delete of a missing blob returned %v, want nil", err)
+	}
+}
+
+func TestS3StoreError(t *testing.T) {
+	store, _, done := newFakeS3Store(t)
+	defer done()
+	store.accessKey = "someone-else"
+
+	err := store.Put("games/1/feedback/a", "text/plain", 1, strings.NewReader("x"))
+	if err == nil || err == ErrNotFound {
+		t.Fatalf("Put with a rejected signature returned %v, want an error", err)
+	}
+	if !strings.Contains(err.Error(), "403") {
+		t.Fatalf("error %q doesn't mention the status", err)
+	}
+}
+
+func TestS3StoreInvalidKey(t *testing.T) {
+	store, _, done := newFakeS3Store(t)
+	defer done()
+
+	for _, key := range []string{"", "/absolute"} {
+		if _, err := store.Get(key); err != ErrInvalidKey {
+			t.Errorf("Get(%q) returned %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
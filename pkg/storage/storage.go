@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"io"
+
+	"lemon/lemon-api/pkg/config"
+)
+
+var (
+	ErrNotFound      = errors.New("blob not found")
+	ErrInvalidKey    = errors.New("invalid blob key")
+	ErrUnknownDriver = errors.New("unknown storage driver")
+)
+
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+
+	defaultLocalPath = "attachments"
+)
+
+// Store keeps uploaded blobs, such as feedback attachments, outside the
+// database. Keys are slash separated paths chosen by the caller.
+type Store interface {
+	Put(key string, contentType string, size int64, body io.Reader) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// New returns the store named by the storage config, defaulting to the local
+// filesystem when none is configured.
+func New(cfg *config.StorageConfig) (Store, error) {
+	if cfg == nil {
+		return NewLocalStore(defaultLocalPath)
+	}
+
+	switch cfg.Driver {
+	case "", DriverLocal:
+		path := cfg.Path
+		if path == "" {
+			path = defaultLocalPath
+		}
+		return NewLocalStore(path)
+	case DriverS3:
+		return NewS3Store(cfg)
+	default:
+		return nil, ErrUnknownDriver
+	}
+}
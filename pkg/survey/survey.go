@@ -0,0 +1,248 @@
+package survey
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	lemon_api "lemon/lemon-api"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidSurvey   = errors.New("invalid survey")
+	ErrInvalidResponse = errors.New("invalid survey response")
+)
+
+const (
+	maxQuestions    = 50
+	maxOptions      = 50
+	maxTextAnswer   = 2000
+	maxTextAnswers  = 100
+	defaultScaleMin = 1
+	defaultScaleMax = 5
+	// maxScalePoints caps how many points a scale may have, as results list
+	// a count for every one of them.
+	maxScalePoints = 100
+)
+
+// ValidateDefinition checks the questions of a survey before it is stored.
+// Scale questions without a range are given the default 1 to 5.
+func ValidateDefinition(questions lemon_api.SurveyQuestions) error {
+	if len(questions) == 0 {
+		return errors.Wrap(ErrInvalidSurvey, "a survey needs at least one question")
+	}
+	if len(questions) > maxQuestions {
+		return errors.Wrap(ErrInvalidSurvey, fmt.Sprintf("a survey can have at most %d questions", maxQuestions))
+	}
+
+	seen := map[string]bool{}
+	for i, question := range questions {
+		if question == nil || question.ID == "" {
+			return errors.Wrap(ErrInvalidSurvey, fmt.Sprintf("question %d has no id", i+1))
+		}
+		if seen[question.ID] {
+			return errors.Wrap(ErrInvalidSurvey, "duplicate question id "+question.ID)
+		}
+		seen[question.ID] = true
+
+		if strings.TrimSpace(question.Prompt) == "" {
+			return errors.Wrap(ErrInvalidSurvey, question.ID+": missing prompt")
+		}
+
+		switch question.Type {
+		case lemon_api.SurveyQuestionScale:
+			if question.Min == 0 && question.Max == 0 {
+				question.Min, question.Max = defaultScaleMin, defaultScaleMax
+			}
+			if question.Min >= question.Max {
+				return errors.Wrap(ErrInvalidSurvey, question.ID+": min must be less than max")
+			}
+			// The difference is taken unsigned so the widest ranges can't
+			// wrap around into small ones.
+			if uint64(question.Max-question.Min) >= maxScalePoints {
+				return errors.Wrap(ErrInvalidSurvey, fmt.Sprintf("%s: a scale can have at most %d points", question.ID, maxScalePoints))
+			}
+			question.Options = nil
+		case lemon_api.SurveyQuestionSingle, lemon_api.SurveyQuestionMultiple:
+			if len(question.Options) < 2 || len(question.Options) > maxOptions {
+				return errors.Wrap(ErrInvalidSurvey, fmt.Sprintf("%s: needs between 2 and %d options", question.ID, maxOptions))
+			}
+			options := map[string]bool{}
+			for _, option := range question.Options {
+				if option == "" || options[option] {
+					return errors.Wrap(ErrInvalidSurvey, question.ID+": options must be unique and not empty")
+				}
+				options[option] = true
+			}
+			question.Min, question.Max = 0, 0
+		case lemon_api.SurveyQuestionText:
+			question.Options = nil
+			question.Min, question.Max = 0, 0
+		default:
+			return errors.Wrap(ErrInvalidSurvey, question.ID+": unknown question type "+question.Type)
+		}
+	}
+
+	return nil
+}
+
+// ValidateAnswers checks a response against the survey it answers. The
+// returned error names the first question that was answered wrongly.
+func ValidateAnswers(questions lemon_api.SurveyQuestions, answers lemon_api.SurveyAnswers) error {
+	byID := make(map[string]*lemon_api.SurveyQuestion, len(questions))
+	for _, question := range questions {
+		byID[question.ID] = question
+	}
+	for id := range answers {
+		if _, ok := byID[id]; !ok {
+			return errors.Wrap(ErrInvalidResponse, "unknown question "+id)
+		}
+	}
+
+	for _, question := range questions {
+		answer, ok := answers[question.ID]
+		if !ok || answer == nil {
+			if question.Required {
+				return errors.Wrap(ErrInvalidResponse, question.ID+": answer required")
+			}
+			continue
+		}
+		if err := validateAnswer(question, answer); err != nil {
+			return errors.Wrap(ErrInvalidResponse, question.ID+": "+err.Error())
+		}
+	}
+
+	return nil
+}
+
+func validateAnswer(question *lemon_api.SurveyQuestion, answer interface{}) error {
+	switch question.Type {
+	case lemon_api.SurveyQuestionScale:
+		value, ok := answer.(float64)
+		if !ok || value != math.Trunc(value) {
+			return errors.New("must be a whole number")
+		}
+		if int64(value) < question.Min || int64(value) > question.Max {
+			return fmt.Errorf("must be between %d and %d", question.Min, question.Max)
+		}
+	case lemon_api.SurveyQuestionSingle:
+		value, ok := answer.(string)
+		if !ok || !hasOption(question, value) {
+			return errors.New("must be one of the options")
+		}
+	case lemon_api.SurveyQuestionMultiple:
+		values, ok := answer.([]interface{})
+		if !ok {
+			return errors.New("must be a list of options")
+		}
+		if question.Required && len(values) == 0 {
+			return errors.New("answer required")
+		}
+		picked := map[string]bool{}
+		for _, v := range values {
+			value, ok := v.(string)
+			if !ok || !hasOption(question, value) || picked[value] {
+				return errors.New("must be a list of distinct options")
+			}
+			picked[value] = true
+		}
+	case lemon_api.SurveyQuestionText:
+		value, ok := answer.(string)
+		if !ok {
+			return errors.New("must be text")
+		}
+		if question.Required && strings.TrimSpace(value) == "" {
+			return errors.New("answer required")
+		}
+		if len(value) > maxTextAnswer {
+			return fmt.Errorf("must be at most %d characters", maxTextAnswer)
+		}
+	}
+	return nil
+}
+
+func hasOption(question *lemon_api.SurveyQuestion, value string) bool {
+	for _, option := range question.Options {
+		if option == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Aggregate turns per answer counts into per question results: counts for
+// every option or scale point, the average for scales, and the most common
+// free text answers. answered holds the number of responses that answered
+// each question.
+func Aggregate(survey *lemon_api.Survey, responses int64, answered map[string]int64, counts []*lemon_api.SurveyAnswerCount) *lemon_api.SurveyResults {
+	byQuestion := map[string][]*lemon_api.SurveyAnswerCount{}
+	for _, count := range counts {
+		byQuestion[count.QuestionID] = append(byQuestion[count.QuestionID], count)
+	}
+
+	results := &lemon_api.SurveyResults{
+		SurveyID:  survey.ID,
+		Responses: responses,
+		Questions: make([]*lemon_api.SurveyQuestionResult, 0, len(survey.Questions)),
+	}
+
+	for _, question := range survey.Questions {
+		result := &lemon_api.SurveyQuestionResult{
+			ID:       question.ID,
+			Type:     question.Type,
+			Prompt:   question.Prompt,
+			Answered: answered[question.ID],
+		}
+		answers := byQuestion[question.ID]
+
+		switch question.Type {
+		case lemon_api.SurveyQuestionScale:
+			result.Counts = map[string]int64{}
+			for point := question.Min; point <= question.Max; point++ {
+				result.Counts[strconv.FormatInt(point, 10)] = 0
+			}
+			var total float64
+			var scored int64
+			for _, answer := range answers {
+				value, err := strconv.ParseFloat(answer.Answer, 64)
+				if err != nil {
+					continue
+				}
+				result.Counts[answer.Answer] += answer.Count
+				total += value * float64(answer.Count)
+				scored += answer.Count
+			}
+			if scored > 0 {
+				average := total / float64(scored)
+				result.Average = &average
+			}
+		case lemon_api.SurveyQuestionSingle, lemon_api.SurveyQuestionMultiple:
+			result.Counts = map[string]int64{}
+			for _, option := range question.Options {
+				result.Counts[option] = 0
+			}
+			for _, answer := range answers {
+				if _, ok := result.Counts[answer.Answer]; ok {
+					result.Counts[answer.Answer] += answer.Count
+				}
+			}
+		case lemon_api.SurveyQuestionText:
+			sort.SliceStable(answers, func(i, j int) bool {
+				return answers[i].Count > answers[j].Count
+			})
+			for _, answer := range answers {
+				if len(result.Answers) < maxTextAnswers && strings.TrimSpace(answer.Answer) != "" {
+					result.Answers = append(result.Answers, answer.Answer)
+				}
+			}
+		}
+
+		results.Questions = append(results.Questions, result)
+	}
+
+	return results
+}
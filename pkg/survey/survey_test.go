@@ -0,0 +1,44 @@
+package survey
+
+import (
+	"math"
+	"testing"
+
+	lemon_api "lemon/lemon-api"
+
+	"github.com/pkg/errors"
+)
+
+func TestValidateDefinitionScaleRange(t *testing.T) {
+	tests := []struct {
+		min, max int64
+		valid    bool
+	}{
+		{min: 0, max: 0, valid: true},
+		{min: 1, max: 10, valid: true},
+		{min: 0, max: 99, valid: true},
+		{min: -50, max: 49, valid: true},
+		{min: 5, max: 5},
+		{min: 10, max: 1},
+		{min: 0, max: 100},
+		{min: 1, max: math.MaxInt64},
+		{min: math.MinInt64, max: math.MaxInt64},
+		{min: math.MinInt64, max: 0},
+	}
+	for _, test := range tests {
+		questions := lemon_api.SurveyQuestions{{
+			ID:     "fun",
+			Type:   lemon_api.SurveyQuestionScale,
+			Prompt: "How fun was it?",
+			Min:    test.min,
+			Max:    test.max,
+		}}
+		err := ValidateDefinition(questions)
+		if test.valid && err != nil {
+			t.Errorf("scale %d to %d returned %v", test.min, test.max, err)
+		}
+		if !test.valid && errors.Cause(err) != ErrInvalidSurvey {
+			t.Errorf("scale %d to %d returned %v, want ErrInvalidSurvey", test.min, test.max, err)
+		}
+	}
+}
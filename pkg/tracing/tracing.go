@@ -0,0 +1,181 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"lemon/lemon-api/pkg/config"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters spans can be sent to.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+const (
+	defaultServiceName  = "lemon-api"
+	instrumentationName = "lemon/lemon-api"
+)
+
+var ErrUnknownExporter = errors.New("unknown trace exporter")
+
+func init() {
+	// Trace context is read from and passed on in W3C headers even when no
+	// exporter is configured, so traces started upstream aren't broken here.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+}
+
+// Tracer starts lemon's spans. Until a Provider is installed they are not
+// recorded.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Provider records spans and hands them to an exporter.
+type Provider struct {
+	provider *sdktrace.TracerProvider
+}
+
+// New installs a Provider exporting to wherever cfg says. Without a config,
+// or with the none exporter, it returns nil and spans aren't recorded.
+func New(cfg *config.TracingConfig) (*Provider, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, err
+		}
+		exporter = stdout
+	case ExporterOTLP:
+		options := []otlptracehttp.Option{}
+		if cfg.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			options = append(options, otlptracehttp.WithHeaders(cfg.Headers))
+		}
+		// Spans are posted over HTTP as they are batched, so a collector
+		// that is down doesn't stop the API starting.
+		otlp, err := otlptracehttp.New(context.Background(), options...)
+		if err != nil {
+			return nil, err
+		}
+		exporter = otlp
+	default:
+		return nil, ErrUnknownExporter
+	}
+	return Install(cfg, sdktrace.WithBatcher(exporter)), nil
+}
+
+// Install makes a Provider the global one, exporting spans as options say.
+// Tests pass sdktrace.WithSyncer(tracetest.NewInMemoryExporter()) so spans
+// can be read back as soon as they end.
+func Install(cfg *config.TracingConfig, options ...sdktrace.TracerProviderOption) *Provider {
+	serviceName := defaultServiceName
+	sampleRatio := 1.0
+	if cfg != nil {
+		if cfg.ServiceName != "" {
+			serviceName = cfg.ServiceName
+		}
+		if cfg.SampleRatio > 0 {
+			sampleRatio = cfg.SampleRatio
+		}
+	}
+
+	options = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+		)),
+		// Follow the caller's sampling decision so a trace is either
+		// recorded everywhere or nowhere.
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	}, options...)
+
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	return &Provider{provider: provider}
+}
+
+// Shutdown exports any spans still buffered and stops the exporter.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	return p.provider.Shutdown(ctx)
+}
+
+// Middleware starts a span for every request, continuing the trace in its
+// traceparent header if it has one. Spans are named by route pattern, such as
+// GET /api/games/:game/feedback, and the request's context carries the span so
+// the database and anything else it calls can add theirs beneath it.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		name := c.Request.Method + " " + route
+		if route == "" {
+			name = c.Request.Method + " unmatched"
+		}
+		ctx, span := Tracer().Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", route, c.Request)...),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(status))
+		if len(c.Errors) > 0 {
+			span.SetAttributes(attribute.String("gin.errors", c.Errors.String()))
+		}
+	}
+}
+
+// Traceparent is the W3C traceparent header for the span in ctx, or empty
+// when ctx isn't part of a trace. It lets work queued now, such as a
+// webhook delivery, be traced as part of the request that queued it.
+func Traceparent(ctx context.Context) string {
+	carrier := propagation.HeaderCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// WithTraceparent continues the trace in a traceparent header from
+// Traceparent, so spans started from the returned context join it.
+func WithTraceparent(ctx context.Context, traceparent string) context.Context {
+	carrier := propagation.HeaderCarrier{}
+	carrier.Set("traceparent", traceparent)
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
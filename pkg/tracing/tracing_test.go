@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const incomingTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := Install(nil, sdktrace.WithSyncer(exporter))
+	defer provider.Shutdown(context.Background())
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(Middleware())
+	engine.GET("api/games/:game/feedback", func(c *gin.Context) {
+		if !trace.SpanContextFromContext(c.Request.Context()).IsValid() {
+			t.Error("handler's context doesn't carry the request span")
+		}
+		c.Status(http.StatusTeapot)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/games/lemon/feedback", nil)
+	req.Header.Set("traceparent", incomingTraceparent)
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "GET /api/games/:game/feedback" {
+		t.Errorf("span named %q, want it named by route", span.Name)
+	}
+	if span.SpanKind != trace.SpanKindServer {
+		t.Errorf("span kind %v, want server", span.SpanKind)
+	}
+	if got := span.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("span is in trace %s, want the caller's", got)
+	}
+	if got := span.Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("span's parent is %s, want the caller's span", got)
+	}
+}
+
+func TestTraceparent(t *testing.T) {
+	if got := Traceparent(context.Background()); got != "" {
+		t.Errorf("Traceparent outside a trace = %q, want empty", got)
+	}
+
+	ctx := WithTraceparent(context.Background(), incomingTraceparent)
+	if got := Traceparent(ctx); got != incomingTraceparent {
+		t.Errorf("Traceparent = %q, want %q", got, incomingTraceparent)
+	}
+}
@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	lemon_api "lemon/lemon-api"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const digestCheckInterval = time.Minute
+
+// digestPeriods is how long each digest covers. Periods start on the hour, or
+// at midnight, UTC.
+var digestPeriods = map[string]time.Duration{
+	lemon_api.DigestHourly: time.Hour,
+	lemon_api.DigestDaily:  24 * time.Hour,
+}
+
+// DigestStore is where the scheduler finds feedback to summarise and queues
+// digests for the dispatcher.
+type DigestStore interface {
+	GetDigestGames(from time.Time, to time.Time) ([]string, error)
+	EnqueueFeedbackDigest(gameID string, period string, from time.Time, to time.Time, notifiers []string) (*lemon_api.FeedbackDigest, error)
+}
+
+// Scheduler queues a feedback digest for every game once each hourly or daily
+// period ends, for the notifiers that asked for one. Only the period that just
+// ended is sent; any missed while the server was down are skipped.
+type Scheduler struct {
+	store   DigestStore
+	periods map[string][]string
+	sent    map[string]time.Time
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewScheduler takes the notifiers wanting each period, as notify.Digests
+// returns them.
+func NewScheduler(store DigestStore, periods map[string][]string) *Scheduler {
+	return &Scheduler{
+		store:   store,
+		periods: periods,
+		sent:    map[string]time.Time{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start checks for finished periods every minute until Stop is called. It
+// does nothing if no notifier wants digests.
+func (s *Scheduler) Start() {
+	if len(s.periods) == 0 {
+		close(s.done)
+		return
+	}
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(digestCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			s.run(time.Now().UTC())
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop waits for the digests in progress to be queued and stops checking.
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
+
+// run queues the digests for any period that has ended since the last run.
+// A period that fails for any game is tried again next time; games that
+// already got theirs are skipped by the store.
+func (s *Scheduler) run(now time.Time) {
+	names := make([]string, 0, len(s.periods))
+	for period := range s.periods {
+		names = append(names, period)
+	}
+	sort.Strings(names)
+
+	for _, period := range names {
+		length, ok := digestPeriods[period]
+		if !ok {
+			continue
+		}
+		to := now.Truncate(length)
+		if s.sent[period].Equal(to) {
+			continue
+		}
+		if s.digest(period, to.Add(-length), to) {
+			s.sent[period] = to
+		}
+	}
+}
+
+func (s *Scheduler) digest(period string, from time.Time, to time.Time) bool {
+	games, err := s.store.GetDigestGames(from, to)
+	if err != nil {
+		return false
+	}
+
+	ok := true
+	for _, gameID := range games {
+		select {
+		case <-s.stop:
+			return false
+		default:
+		}
+
+		if _, err := s.store.EnqueueFeedbackDigest(gameID, period, from, to, s.periods[period]); err != nil {
+			log.WithFields(log.Fields{
+				"err":    err,
+				"game":   gameID,
+				"period": period,
+			}).Error("Failed to queue feedback digest")
+			ok = false
+		}
+	}
+	return ok
+}
@@ -0,0 +1,264 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/config"
+	"lemon/lemon-api/pkg/metrics"
+	"lemon/lemon-api/pkg/notify"
+	"lemon/lemon-api/pkg/tracing"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultMaxAttempts  = 8
+	defaultPollInterval = 5 * time.Second
+	baseRetryDelay      = 10 * time.Second
+	maxRetryDelay       = time.Hour
+	deliveryLease       = 2 * time.Minute
+	// batchSize is how many deliveries are claimed under one lease. Each may
+	// take up to sendTimeout, and half the lease is left over for recording
+	// the attempts, so a claimed delivery is never still being sent when its
+	// lease runs out and another instance claims it again.
+	batchSize = int(deliveryLease / (2 * sendTimeout))
+)
+
+// Store is the outbox the dispatcher delivers from.
+type Store interface {
+	ClaimWebhookDeliveries(limit int, leaseUntil time.Time) ([]*lemon_api.WebhookDelivery, error)
+	CompleteWebhookDelivery(ID int64, lastStatus int, duration time.Duration) error
+	FailWebhookDelivery(ID int64, nextAttempt time.Time, dead bool, lastStatus *int, lastError string, duration time.Duration) error
+	GetDeliverySubscription(ID int64) (*lemon_api.WebhookSubscription, error)
+}
+
+// Dispatcher delivers queued webhook events to notifiers and subscriptions in
+// the background, retrying failures with exponential backoff until they are
+// dead lettered.
+type Dispatcher struct {
+	store        Store
+	notifiers    map[string]notify.Notifier
+	client       *http.Client
+	maxAttempts  int
+	pollInterval time.Duration
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewDispatcher(store Store, notifiers map[string]notify.Notifier, cfg *config.Webhooks) *Dispatcher {
+	d := &Dispatcher{
+		store:        store,
+		notifiers:    notifiers,
+		client:       newSubscriptionClient(cfg != nil && cfg.AllowPrivateURLs),
+		maxAttempts:  defaultMaxAttempts,
+		pollInterval: defaultPollInterval,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	if cfg != nil {
+		if cfg.MaxAttempts > 0 {
+			d.maxAttempts = cfg.MaxAttempts
+		}
+		if cfg.PollInterval > 0 {
+			d.pollInterval = time.Duration(cfg.PollInterval) * time.Second
+		}
+	}
+	return d
+}
+
+// Start polls the outbox until Stop is called.
+func (d *Dispatcher) Start() {
+	go func() {
+		defer close(d.done)
+
+		ticker := time.NewTicker(d.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			d.dispatch()
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop waits for the delivery in progress to finish and stops polling.
+func (d *Dispatcher) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+	<-d.done
+}
+
+// dispatch delivers batches of due events until the outbox has caught up.
+func (d *Dispatcher) dispatch() {
+	for {
+		leaseUntil := time.Now().UTC().Add(deliveryLease)
+		deliveries, err := d.store.ClaimWebhookDeliveries(batchSize, leaseUntil)
+		if err != nil {
+			return
+		}
+
+		for _, delivery := range deliveries {
+			select {
+			case <-d.stop:
+				return
+			default:
+			}
+			// Should slow store writes eat into the lease, the rest of the
+			// batch is left to be claimed again once it runs out rather
+			// than risk sending it twice.
+			if time.Until(leaseUntil) < 2*sendTimeout {
+				log.WithFields(log.Fields{
+					"delivery": delivery.ID,
+				}).Warn("Webhook lease running out, leaving the rest of the batch")
+				return
+			}
+			d.deliver(delivery)
+		}
+
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+// deliver sends a delivery, tracing it as part of the request that queued it
+// when there was one.
+func (d *Dispatcher) deliver(delivery *lemon_api.WebhookDelivery) {
+	ctx := context.Background()
+	if delivery.Traceparent != nil {
+		ctx = tracing.WithTraceparent(ctx, *delivery.Traceparent)
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "webhook "+delivery.Event,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.Int64("webhook.delivery", delivery.ID),
+			attribute.String("webhook.event", delivery.Event),
+			attribute.String("webhook.sink", delivery.Sink),
+			attribute.Int("webhook.attempt", delivery.Attempts+1),
+		),
+	)
+	defer span.End()
+
+	started := time.Now()
+	status, err := d.send(ctx, delivery)
+	duration := time.Since(started)
+	if status != 0 {
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	if err == nil {
+		metrics.ObserveWebhook(delivery.Sink, delivery.Event, metrics.OutcomeDelivered, duration)
+		if err := d.store.CompleteWebhookDelivery(delivery.ID, status, duration); err != nil {
+			log.WithFields(log.Fields{
+				"err":      err,
+				"delivery": delivery.ID,
+			}).Error("Failed to mark webhook delivered")
+		}
+		return
+	}
+
+	var lastStatus *int
+	var retryAfter time.Duration
+	dead := delivery.Attempts+1 >= d.maxAttempts
+	switch e := err.(type) {
+	case *notify.StatusError:
+		lastStatus = &e.StatusCode
+		retryAfter = e.RetryAfter
+	case undeliverableError:
+		dead = true
+	}
+	outcome := metrics.OutcomeRetry
+	if dead {
+		outcome = metrics.OutcomeDead
+	}
+	metrics.ObserveWebhook(delivery.Sink, delivery.Event, outcome, duration)
+	d.fail(delivery, dead, lastStatus, err.Error(), retryAfter, duration)
+}
+
+// undeliverableError is a delivery that can never succeed, so retrying it is
+// pointless.
+type undeliverableError string
+
+func (e undeliverableError) Error() string {
+	return string(e)
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *lemon_api.WebhookDelivery) (int, error) {
+	if delivery.SubscriptionID != nil {
+		subscription, err := d.store.GetDeliverySubscription(*delivery.SubscriptionID)
+		if err == sql.ErrNoRows {
+			return 0, undeliverableError("subscription deleted")
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !subscription.Active {
+			return 0, undeliverableError("subscription disabled")
+		}
+		return d.sendSubscription(ctx, delivery, subscription)
+	}
+
+	notifier, ok := d.notifiers[delivery.Sink]
+	if !ok {
+		return 0, undeliverableError(fmt.Sprintf("unknown notifier %q", delivery.Sink))
+	}
+	return notifier.Send(ctx, delivery)
+}
+
+func (d *Dispatcher) fail(delivery *lemon_api.WebhookDelivery, dead bool, lastStatus *int, message string, retryAfter time.Duration, duration time.Duration) {
+	delay := backoff(delivery.Attempts + 1)
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+
+	log.WithFields(log.Fields{
+		"delivery": delivery.ID,
+		"event":    delivery.Event,
+		"sink":     delivery.Sink,
+		"attempts": delivery.Attempts + 1,
+		"dead":     dead,
+		"err":      message,
+	}).Warn("Webhook delivery failed")
+
+	if err := d.store.FailWebhookDelivery(delivery.ID, time.Now().UTC().Add(delay), dead, lastStatus, message, duration); err != nil {
+		log.WithFields(log.Fields{
+			"err":      err,
+			"delivery": delivery.ID,
+		}).Error("Failed to record webhook failure")
+	}
+}
+
+// backoff doubles the delay after every attempt, with up to 20% jitter so
+// retries from a burst of failures spread out.
+func backoff(attempt int) time.Duration {
+	delay := baseRetryDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
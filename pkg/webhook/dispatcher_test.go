@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/config"
+	"lemon/lemon-api/pkg/tracing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeStore hands out a single subscription and records how deliveries went.
+type fakeStore struct {
+	subscription *lemon_api.WebhookSubscription
+	completed    []int64
+	failed       []string
+}
+
+func (s *fakeStore) ClaimWebhookDeliveries(limit int, leaseUntil time.Time) ([]*lemon_api.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) CompleteWebhookDelivery(ID int64, lastStatus int, duration time.Duration) error {
+	s.completed = append(s.completed, ID)
+	return nil
+}
+
+func (s *fakeStore) FailWebhookDelivery(ID int64, nextAttempt time.Time, dead bool, lastStatus *int, lastError string, duration time.Duration) error {
+	s.failed = append(s.failed, lastError)
+	return nil
+}
+
+func (s *fakeStore) GetDeliverySubscription(ID int64) (*lemon_api.WebhookSubscription, error) {
+	return s.subscription, nil
+}
+
+func TestDeliveryContinuesTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.Install(nil, sdktrace.WithSyncer(exporter))
+	defer provider.Shutdown(context.Background())
+
+	var received http.Header
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer receiver.Close()
+
+	store := &fakeStore{subscription: &lemon_api.WebhookSubscription{
+		ID:     1,
+		URL:    receiver.URL,
+		Secret: "secret",
+		Active: true,
+	}}
+	d := NewDispatcher(store, nil, &config.Webhooks{AllowPrivateURLs: true})
+
+	subscriptionID := int64(1)
+	queuedBy := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	d.deliver(&lemon_api.WebhookDelivery{
+		ID:             7,
+		Event:          lemon_api.WebhookEventFeedbackCreated,
+		Sink:           lemon_api.WebhookSinkSubscription,
+		SubscriptionID: &subscriptionID,
+		Payload:        []byte(`{}`),
+		Traceparent:    &queuedBy,
+	})
+
+	if len(store.completed) != 1 {
+		t.Fatalf("delivery wasn't completed, failures: %v", store.failed)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "webhook "+lemon_api.WebhookEventFeedbackCreated {
+		t.Errorf("span named %q", span.Name)
+	}
+	if got := span.Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("delivery span's parent is %s, want the span that queued it", got)
+	}
+
+	traceparent := received.Get("traceparent")
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.SpanContext.SpanID().String() + "-01"
+	if traceparent != want {
+		t.Errorf("traceparent header = %q, want %q", traceparent, want)
+	}
+	if !strings.HasPrefix(received.Get(HeaderSignature), signatureVersion+"=") {
+		t.Errorf("delivery wasn't signed: %q", received.Get(HeaderSignature))
+	}
+}
@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	lemon_api "lemon/lemon-api"
+	"lemon/lemon-api/pkg/notify"
+
+	"github.com/pkg/errors"
+)
+
+// Headers sent with every subscription delivery. Receivers verify a delivery
+// by computing the HMAC-SHA256 of "<timestamp>.<body>" with their secret and
+// comparing it against each v1= value in the signature header; there are two
+// while a rotated secret is still in its grace period. Rejecting timestamps
+// more than a few minutes old stops replays.
+const (
+	HeaderEvent     = "X-Lemon-Event"
+	HeaderDelivery  = "X-Lemon-Delivery"
+	HeaderTimestamp = "X-Lemon-Timestamp"
+	HeaderSignature = "X-Lemon-Signature"
+
+	signatureVersion = "v1"
+	sendTimeout      = notify.SendTimeout
+)
+
+var (
+	ErrInvalidURL = errors.New("invalid subscription url")
+
+	errPrivateAddress = errors.New("subscription url resolves to a private address")
+)
+
+// Envelope is the body of a subscription delivery.
+type Envelope struct {
+	ID      int64           `json:"id"`
+	Event   string          `json:"event"`
+	Game    EnvelopeGame    `json:"game"`
+	Created *time.Time      `json:"created"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type EnvelopeGame struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// Sign is the hex HMAC-SHA256 of the timestamp and body under secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Signature is the signature header for a delivery, signed with the current
+// secret and, until it expires, the previous one.
+func Signature(subscription *lemon_api.WebhookSubscription, timestamp int64, body []byte, now time.Time) string {
+	signatures := []string{signatureVersion + "=" + Sign(subscription.Secret, timestamp, body)}
+	if subscription.PreviousSecret != nil && subscription.PreviousSecretExpires != nil &&
+		now.Before(*subscription.PreviousSecretExpires) {
+		signatures = append(signatures, signatureVersion+"="+Sign(*subscription.PreviousSecret, timestamp, body))
+	}
+	return strings.Join(signatures, ",")
+}
+
+// ValidateURL checks a subscription URL before it is saved. Unless private
+// URLs are allowed it must be https and must not name a private address;
+// hostnames are checked again when the delivery connects.
+func ValidateURL(raw string, allowPrivate bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.Wrap(ErrInvalidURL, "url must be absolute")
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && allowPrivate:
+	default:
+		return errors.Wrap(ErrInvalidURL, "url must be https")
+	}
+	if u.User != nil {
+		return errors.Wrap(ErrInvalidURL, "url must not contain credentials")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !allowPrivate && privateIP(ip) {
+		return errors.Wrap(ErrInvalidURL, errPrivateAddress.Error())
+	}
+	return nil
+}
+
+// newSubscriptionClient is the client subscription deliveries are sent with.
+// It doesn't follow redirects, and unless private URLs are allowed it refuses
+// to connect to private, loopback and link local addresses, whatever DNS says.
+func newSubscriptionClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: sendTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || privateIP(ip) {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: sendTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: sendTimeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+var privateNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+	} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+func privateIP(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendSubscription signs and posts a delivery to its subscription. The trace in
+// ctx is passed on in W3C traceparent headers.
+func (d *Dispatcher) sendSubscription(ctx context.Context, delivery *lemon_api.WebhookDelivery, subscription *lemon_api.WebhookSubscription) (int, error) {
+	body, err := json.Marshal(Envelope{
+		ID:    delivery.ID,
+		Event: delivery.Event,
+		Game: EnvelopeGame{
+			ID:   delivery.GameID,
+			Slug: delivery.GameSlug,
+			Name: delivery.GameName,
+		},
+		Created: delivery.Created,
+		Data:    delivery.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	timestamp := now.Unix()
+	headers := map[string]string{
+		HeaderEvent:     delivery.Event,
+		HeaderDelivery:  strconv.FormatInt(delivery.ID, 10),
+		HeaderTimestamp: strconv.FormatInt(timestamp, 10),
+		HeaderSignature: Signature(subscription, timestamp, body, now),
+	}
+	return notify.Post(ctx, d.client, subscription.URL, headers, body)
+}